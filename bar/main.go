@@ -2,6 +2,7 @@ package bar
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"fmt"
@@ -10,15 +11,16 @@ import (
 	"net"
 	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"regexp"
 	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
-	"wm/hypr"
-	"wm/sway"
+	"wm/common"
 
 	"github.com/kovidgoyal/kitty/tools/tty"
 	"github.com/kovidgoyal/kitty/tools/tui/loop"
@@ -79,6 +81,12 @@ type state struct {
 	battery_history              map[string]*battery_history
 	income_data                  income_data
 	workspace_name, window_title string
+	active_window_id             string
+	compositor                   common.Compositor
+	stack                        []stack_member
+	stack_refresh_requests       chan struct{}
+	click_regions                []click_region
+	wm_disconnected              bool
 	wm_initialized               bool
 	lock                         sync.Mutex
 }
@@ -93,6 +101,16 @@ func (s *state) report_failure(segment string, err error) {
 	}
 }
 
+type stack_member struct {
+	id, title string
+}
+
+// click_region is a range of columns in the bar that focuses a window when clicked
+type click_region struct {
+	start, end int
+	window_id  string
+}
+
 type Segment struct {
 	name, text string
 	bg, fg     style.RGBA
@@ -628,22 +646,58 @@ func (self *state) mail() (s Segment) {
 
 // workspace {{{
 
-func (self *state) set_wm_string(which, value string) {
-	self.set_wm_strings(which + ":" + value)
+// Strip the number prefix from sway style num:name workspace names
+func workspace_display_name(name string) string {
+	if num, rest, found := strings.Cut(name, ":"); found {
+		if _, err := strconv.Atoi(num); err == nil {
+			return rest
+		}
+	}
+	return name
 }
 
-func (self *state) set_wm_strings(vals ...string) {
+func (self *state) handle_wm_event(ev common.Event) {
+	refresh_stack := false
 	self.lock.Lock()
-	for _, x := range vals {
-		which, value, _ := strings.Cut(x, ":")
-		switch which {
-		case "title":
-			self.window_title = value
-		case "workspace":
-			self.workspace_name = value
+	switch ev := ev.(type) {
+	case common.WorkspaceFocused:
+		self.workspace_name = workspace_display_name(ev.Name)
+	case common.WindowFocused:
+		self.active_window_id = ev.Id
+		self.window_title = ev.Title
+		// focus moving within the stack does not change its members
+		refresh_stack = !slices.ContainsFunc(self.stack, func(m stack_member) bool { return m.id == ev.Id })
+	case common.TitleChanged:
+		if ev.Id == self.active_window_id {
+			self.window_title = ev.Title
+		}
+		for i, m := range self.stack {
+			if m.id == ev.Id {
+				self.stack[i].title = ev.Title
+			}
 		}
+	case common.WindowClosed:
+		self.stack = slices.DeleteFunc(self.stack, func(m stack_member) bool { return m.id == ev.Id })
+	case common.StackChanged:
+		refresh_stack = true
+	case common.ConnectionState:
+		self.wm_disconnected = !ev.Connected
+		if ev.Err != nil {
+			debugprintln("Lost connection to the compositor with error:", ev.Err)
+		}
+	case common.Bell:
+		// See https://github.com/hyprwm/Hyprland/discussions/10428
+		// Eventually use: https://specifications.freedesktop.org/sound-theme-spec/latest/sound_lookup.html
+		// to avoid hardcoding sound file path.
+		cmd := exec.Command("pw-play", "/usr/share/sounds/ocean/stereo/bell.oga")
+		go func() {
+			cmd.Run()
+		}()
 	}
 	self.lock.Unlock()
+	if refresh_stack {
+		self.request_stack_refresh()
+	}
 	self.lp.WakeupMainThread()
 }
 
@@ -657,20 +711,131 @@ func (self *state) workspace() (s Segment) {
 	}()
 	if !self.wm_initialized {
 		self.wm_initialized = true
-		switch {
-		case hypr.IsHyprlandRunning():
-			if err = hypr.HyprBar(self.set_wm_strings); err != nil {
-				return
+		var c common.Compositor
+		if c, err = common.DetectCompositor(); err != nil {
+			return
+		}
+		var events <-chan common.Event
+		if events, err = c.Subscribe(context.Background()); err != nil {
+			return
+		}
+		self.compositor = c
+		self.stack_refresh_requests = make(chan struct{}, 1)
+		go func() {
+			for range self.stack_refresh_requests {
+				self.refresh_stack()
+				self.lp.WakeupMainThread()
 			}
-		case sway.IsSwayRunning():
-			if err = sway.SwayBar(self.set_wm_string); err != nil {
-				return
+		}()
+		go func() {
+			// sway has no events for layout changes, so there the stack is
+			// refreshed periodically instead
+			var ticks <-chan time.Time
+			if c.Name() == "sway" {
+				ticker := time.NewTicker(stack_refresh_interval)
+				defer ticker.Stop()
+				ticks = ticker.C
 			}
-		default:
-			err = fmt.Errorf("No supported Wayland compositor is running")
+			for {
+				select {
+				case ev, ok := <-events:
+					if !ok {
+						return
+					}
+					self.handle_wm_event(ev)
+				case <-ticks:
+					self.request_stack_refresh()
+				}
+			}
+		}()
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	// show stale state while reconnecting to the compositor
+	return Segment{text: " " + self.workspace_name + " ", fg: BLACK, bold: true, bg: utils.IfElse(self.wm_disconnected, ORANGE, WHITE)}
+}
+
+// }}}
+
+// stack {{{
+
+const stack_refresh_interval = 2 * time.Second
+
+// request_stack_refresh queues a query of the stack without blocking the
+// caller, requests made while one is pending are merged into it
+func (self *state) request_stack_refresh() {
+	if self.stack_refresh_requests == nil {
+		return
+	}
+	select {
+	case self.stack_refresh_requests <- struct{}{}:
+	default:
+	}
+}
+
+// refresh_stack queries the windows in the stack of the focused window, that
+// is the group in Hyprland or the stacked or tabbed container in sway
+func (self *state) refresh_stack() {
+	windows, err := self.compositor.FocusedStack()
+	if err != nil {
+		debugprintln("Failed to query the stack of the focused window with error:", err)
+		return
+	}
+	members := make([]stack_member, len(windows))
+	for i, w := range windows {
+		members[i] = stack_member{w.Id, w.Title}
+	}
+	self.lock.Lock()
+	self.stack = members
+	self.lock.Unlock()
+}
+
+// stack_segment shows the titles of the windows in the stack, truncated to
+// fit in width cells, with the active window highlighted. The returned
+// regions are the columns occupied by each window, relative to the start of
+// the segment.
+func stack_segment(members []stack_member, active string, width int) (s Segment, regions []click_region) {
+	// every title is padded by a space on both sides and followed by a divider
+	title_width := width/len(members) - 3
+	if title_width < 1 {
+		// too narrow to show every window, show only the active one
+		members = utils.Filter(members, func(m stack_member) bool { return m.id == active })
+		if title_width = width - 3; title_width < 1 || len(members) == 0 {
+			s.skip = true
+			return
+		}
+	}
+	segments := make([]Segment, len(members))
+	pos := 0
+	for i, m := range members {
+		title := m.title
+		if wcswidth.Stringwidth(title) > title_width {
+			title = wcswidth.TruncateToVisualLength(title, title_width-1) + "…"
+		}
+		text := " " + title + " "
+		segments[i] = Segment{text: text, fg: LIGHT_GRAY, bg: DARK_GRAY}
+		if m.id == active {
+			segments[i].fg, segments[i].bg, segments[i].bold = WHITE, MEDIUM_GRAY, true
+		}
+		w := wcswidth.Stringwidth(text)
+		regions = append(regions, click_region{pos, pos + w, m.id})
+		pos += w + 1
+	}
+	return concat_segments_soft(LIGHT_GRAY, false, segments...), regions
+}
+
+func (self *state) on_click(x int) {
+	for _, r := range self.click_regions {
+		if r.start <= x && x < r.end {
+			c, id := self.compositor, r.window_id
+			go func() {
+				if err := c.FocusWindow(id); err != nil {
+					debugprintln("Failed to focus window with error:", err)
+				}
+			}()
+			break
 		}
 	}
-	return Segment{text: " " + self.workspace_name + " ", fg: BLACK, bold: true, bg: WHITE}
 }
 
 // }}}
@@ -690,17 +855,33 @@ func (self *state) draw_screen() (err error) {
 		w := self.workspace()
 		workspace_sz := wcswidth.Stringwidth(w.text) + 3
 		space_for_title := columns - right_sz - workspace_sz
-		title := self.window_title
-		if space_for_title > 0 {
-			ntitle := wcswidth.TruncateToVisualLength(title, space_for_title)
-			if len(ntitle) < len(title) {
-				ntitle += "…"
+		self.lock.Lock()
+		stack, active := slices.Clone(self.stack), self.active_window_id
+		self.lock.Unlock()
+		self.click_regions = nil
+		var title_segment Segment
+		if len(stack) > 0 && space_for_title > 0 {
+			title_segment, self.click_regions = stack_segment(stack, active, space_for_title)
+			// the stack follows the workspace and its end separator
+			offset := utils.IfElse(w.skip, 0, wcswidth.Stringwidth(w.text)+1)
+			for i := range self.click_regions {
+				self.click_regions[i].start += offset
+				self.click_regions[i].end += offset
 			}
-			title = " " + ntitle + " "
 		} else {
-			title = ""
+			title := self.window_title
+			if space_for_title > 0 {
+				ntitle := wcswidth.TruncateToVisualLength(title, space_for_title)
+				if len(ntitle) < len(title) {
+					ntitle += "…"
+				}
+				title = " " + ntitle + " "
+			} else {
+				title = ""
+			}
+			title_segment = Segment{text: title, fg: WHITE, bg: DARK_GRAY}
 		}
-		left_text := concat_segments_hard(BLACK, false, w, Segment{text: title, fg: WHITE, bg: DARK_GRAY}).styled_text()
+		left_text := concat_segments_hard(BLACK, false, w, title_segment).styled_text()
 		self.lp.QueueWriteString("\r\x1b[K")
 		self.lp.QueueWriteString(left_text)
 		rpos := columns - right_sz
@@ -734,6 +915,12 @@ func run_loop() {
 	lp.OnWakeup = func() error {
 		return state.draw_screen()
 	}
+	lp.OnMouseEvent = func(ev *loop.MouseEvent) error {
+		if ev.Event_type == loop.MOUSE_PRESS && ev.Buttons&loop.LEFT_MOUSE_BUTTON != 0 {
+			state.on_click(ev.Cell.X)
+		}
+		return nil
+	}
 	err = lp.Run()
 	if err != nil {
 		debugprintln(err)
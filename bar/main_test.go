@@ -0,0 +1,75 @@
+package bar
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"wm/common"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kovidgoyal/kitty/tools/tui/loop"
+)
+
+var _ = fmt.Print
+
+func TestStackSegment(t *testing.T) {
+	members := []stack_member{{"a", "one"}, {"b", "two"}, {"c", "three"}}
+	s, regions := stack_segment(members, "b", 45)
+	if diff := cmp.Diff([]click_region{{0, 5, "a"}, {6, 11, "b"}, {12, 19, "c"}}, regions, cmp.AllowUnexported(click_region{})); diff != "" {
+		t.Fatalf("Unexpected click regions:\n%s", diff)
+	}
+	members[2].title = "a title much too long to fit"
+	s, _ = stack_segment(members, "b", 45)
+	if !strings.Contains(s.text, " a title muc… ") || strings.Contains(s.text, "too long") {
+		t.Fatalf("Long title not truncated: %q", s.text)
+	}
+	if !strings.Contains(s.text, "\x1b[1m\x1b[") || strings.Count(s.text, "\x1b[1m") != 1 {
+		t.Fatalf("Active window not highlighted: %q", s.text)
+	}
+
+	// when too narrow only the active window is shown
+	_, regions = stack_segment(members, "c", 10)
+	if len(regions) != 1 || regions[0].window_id != "c" || regions[0].start != 0 {
+		t.Fatalf("Unexpected click regions: %v", regions)
+	}
+	if s, _ = stack_segment(members, "c", 3); !s.skip {
+		t.Fatalf("Segment not skipped when there is no space")
+	}
+}
+
+func TestStackEvents(t *testing.T) {
+	lp, err := loop.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := &state{lp: lp, stack_refresh_requests: make(chan struct{}, 1)}
+	self.stack = []stack_member{{"a", "one"}, {"b", "two"}, {"c", "three"}}
+	refresh_requested := func() bool {
+		select {
+		case <-self.stack_refresh_requests:
+			return true
+		default:
+			return false
+		}
+	}
+	self.handle_wm_event(common.WindowFocused{Id: "b"})
+	if refresh_requested() {
+		t.Fatalf("Focusing a window in the stack re-queried the stack")
+	}
+	self.handle_wm_event(common.WindowClosed{Id: "a"})
+	if diff := cmp.Diff([]stack_member{{"b", "two"}, {"c", "three"}}, self.stack, cmp.AllowUnexported(stack_member{})); diff != "" {
+		t.Fatalf("Closed window not removed from the stack:\n%s", diff)
+	}
+	if refresh_requested() {
+		t.Fatalf("Closing a window re-queried the stack")
+	}
+	self.handle_wm_event(common.WindowFocused{Id: "x"})
+	if !refresh_requested() {
+		t.Fatalf("Focusing a window outside the stack did not re-query the stack")
+	}
+	self.handle_wm_event(common.StackChanged{Id: "x"})
+	self.handle_wm_event(common.StackChanged{Id: "b"})
+	if !refresh_requested() || refresh_requested() {
+		t.Fatalf("Stack changes were not merged into a single query")
+	}
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+var _ = fmt.Print
+
+// Compositor is the interface implemented by every supported Wayland
+// compositor backend. Backends register themselves via RegisterCompositor
+// and entry points obtain the running one via DetectCompositor.
+type Compositor interface {
+	Name() string
+	// A string that uniquely identifies the running compositor instance
+	InstanceID() string
+	ChangeToWorkspace(name string) error
+	MoveToWorkspace(name string) error
+	// Show the workspace on the focused output, swapping workspaces if it is
+	// visible on another output
+	BringWorkspaceHere(name string) error
+	MoveWorkspaceToOutput(workspace, output string) error
+	// Toggle the current workspace between stacked and tiled layouts
+	ToggleStack() error
+	// Move windows arriving in workspaces stacked by ToggleStack into their
+	// stack, until ctx is cancelled
+	AutoStack(ctx context.Context) error
+	// Cycle through the windows in the current stack if any otherwise through
+	// all windows
+	SuperTab() error
+	GetWindowRegions() ([]WindowRegion, error)
+	// A compositor independent snapshot of windows, workspaces and outputs
+	GetState() (State, error)
+	// The windows in the stack of the focused window, in stack order, empty
+	// if the focused window is not in a stack. Only Id, Class and Title are
+	// filled in.
+	FocusedStack() ([]Window, error)
+	// Focus the window with the specified Window.Id
+	FocusWindow(id string) error
+	// Apply the actions from matching window rules to the window
+	ApplyWindowActions(id string, actions WindowActions) error
+	// Show the named scratchpad if it is hidden, otherwise hide it. The
+	// window is added to the scratchpad if it is not already in it.
+	ToggleScratchpad(name, window_id string) error
+	TogglePower(action, output_name_glob string) error
+	Exit() error
+	GetPIDsForGracefulShutdown() []int
+	// Subscribe returns a channel of compositor events. The stream starts
+	// with WorkspaceFocused and WindowFocused events describing the current
+	// state. Lost connections are re-established, reported via
+	// ConnectionState events and followed by a resync of the state. The
+	// channel is closed when ctx is cancelled.
+	Subscribe(ctx context.Context) (<-chan Event, error)
+}
+
+type UnsupportedError struct {
+	Operation, Compositor string
+}
+
+func (e *UnsupportedError) Error() string {
+	return fmt.Sprintf("%s is unsupported on this compositor (%s)", e.Operation, e.Compositor)
+}
+
+func Unsupported(operation string, c Compositor) error {
+	return &UnsupportedError{Operation: operation, Compositor: c.Name()}
+}
+
+var ErrNoCompositor = fmt.Errorf("No supported Wayland compositor is running")
+
+type compositor_backend struct {
+	name       string
+	is_running func() bool
+	create     func() Compositor
+}
+
+var registry struct {
+	sync.Mutex
+	backends []compositor_backend
+}
+
+// RegisterCompositor makes a backend available to DetectCompositor. Backends
+// are tried in the order they are registered.
+func RegisterCompositor(name string, is_running func() bool, create func() Compositor) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.backends = append(registry.backends, compositor_backend{name, is_running, create})
+}
+
+var detected struct {
+	sync.Mutex
+	c Compositor
+}
+
+// DetectCompositor returns the first registered backend that reports its
+// compositor as running, or ErrNoCompositor.
+func DetectCompositor() (Compositor, error) {
+	detected.Lock()
+	defer detected.Unlock()
+	if detected.c != nil {
+		return detected.c, nil
+	}
+	registry.Lock()
+	backends := registry.backends
+	registry.Unlock()
+	for _, b := range backends {
+		if b.is_running() {
+			detected.c = b.create()
+			return detected.c, nil
+		}
+	}
+	return nil, ErrNoCompositor
+}
@@ -0,0 +1,113 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var _ = fmt.Print
+
+// ConfigDir returns $XDG_CONFIG_HOME/wm falling back to ~/.config/wm
+func ConfigDir() string {
+	cdir := os.Getenv("XDG_CONFIG_HOME")
+	if cdir == "" {
+		home, _ := os.UserHomeDir()
+		cdir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(cdir, "wm")
+}
+
+func ConfigPath() string {
+	return filepath.Join(ConfigDir(), "wm.conf")
+}
+
+// Config is read from ConfigPath(). It has one setting per line, of the form:
+//
+//	key value
+//
+// Fields are separated by spaces or tabs, fields containing them can be
+// enclosed in double quotes. Blank lines and lines starting with # are
+// ignored.
+type Config struct {
+	// Patterns matching the preferred outputs of workspaces, by workspace
+	// name, in order of preference. Set with lines of the form:
+	//   workspace_output workspace_name output_pattern
+	// Workspace names containing spaces must be quoted.
+	Workspace_outputs map[string][]string
+}
+
+func (c Config) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+func ParseConfig(r io.Reader, path string) (ans Config, err error) {
+	ans.Workspace_outputs = make(map[string][]string)
+	scanner := bufio.NewScanner(r)
+	lnum := 0
+	for scanner.Scan() {
+		lnum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		bad_line := func(msg string) error {
+			return fmt.Errorf("%s in line %d of %s: %s", msg, lnum, path, line)
+		}
+		fields, ferr := split_fields(line)
+		if ferr != nil {
+			return ans, bad_line(ferr.Error())
+		}
+		switch key, args := fields[0], fields[1:]; key {
+		case "workspace_output":
+			if len(args) < 2 || args[0] == "" {
+				return ans, bad_line("A workspace name and an output pattern are needed")
+			}
+			// output descriptions contain spaces, so the pattern is the rest of the line
+			ws, pattern := args[0], strings.Join(args[1:], " ")
+			if _, err = filepath.Match(pattern, ""); err != nil {
+				return ans, bad_line("Invalid output pattern")
+			}
+			ans.Workspace_outputs[ws] = append(ans.Workspace_outputs[ws], pattern)
+		default:
+			return ans, bad_line("Unknown setting")
+		}
+	}
+	err = scanner.Err()
+	return
+}
+
+// LoadConfig reads the config file, a missing file is an empty config
+func LoadConfig() (ans Config, err error) {
+	path := ConfigPath()
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ParseConfig(strings.NewReader(""), path)
+		}
+		return
+	}
+	defer f.Close()
+	return ParseConfig(f, path)
+}
+
+// PreferredOutput returns the name of the enabled output that best matches
+// the preferences for the workspace, or an empty string if there are no
+// preferences or no output matches
+func (c Config) PreferredOutput(workspace string, outputs []Output) string {
+	for _, pattern := range c.Workspace_outputs[workspace] {
+		for _, o := range outputs {
+			if o.Enabled && o.Matches(pattern) {
+				return o.Name
+			}
+		}
+	}
+	return ""
+}
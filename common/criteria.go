@@ -0,0 +1,53 @@
+package common
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var _ = fmt.Print
+
+// WindowCriteria selects windows. Unset fields match all windows.
+type WindowCriteria struct {
+	// Regular expressions, matching anywhere in the value
+	Class, Title *regexp.Regexp
+	Pid          int
+	// Workspace name, matched exactly
+	Workspace string
+}
+
+func NewWindowCriteria(class, title string, pid int, workspace string) (ans WindowCriteria, err error) {
+	if class != "" {
+		if ans.Class, err = regexp.Compile(class); err != nil {
+			return ans, fmt.Errorf("Invalid class regular expression: %w", err)
+		}
+	}
+	if title != "" {
+		if ans.Title, err = regexp.Compile(title); err != nil {
+			return ans, fmt.Errorf("Invalid title regular expression: %w", err)
+		}
+	}
+	ans.Pid, ans.Workspace = pid, workspace
+	return
+}
+
+func (self WindowCriteria) IsEmpty() bool {
+	return self.Class == nil && self.Title == nil && self.Pid == 0 && self.Workspace == ""
+}
+
+func (self WindowCriteria) Matches(w *Window) bool {
+	return (self.Class == nil || self.Class.MatchString(w.Class)) &&
+		(self.Title == nil || self.Title.MatchString(w.Title)) &&
+		(self.Pid == 0 || self.Pid == w.Pid) &&
+		(self.Workspace == "" || self.Workspace == w.Workspace)
+}
+
+// Matching returns the windows that match the criteria, in the order they are listed in the state
+func (self *State) Matching(c WindowCriteria) (ans []Window) {
+	for _, w := range self.Windows {
+		if c.Matches(&w) {
+			ans = append(ans, w)
+		}
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package common
+
+import (
+	"fmt"
+)
+
+var _ = fmt.Print
+
+// Event is a compositor event. It is a closed sum type, the concrete types
+// are listed below. Window ids are opaque strings, the address on Hyprland
+// and the container id on sway.
+type Event interface {
+	is_event()
+}
+
+// The focused workspace changed
+type WorkspaceFocused struct {
+	Name, Output string
+}
+
+// The focused window changed, Id is empty when no window is focused
+type WindowFocused struct {
+	Id, Class, Title string
+}
+
+type TitleChanged struct {
+	Id, Title string
+}
+
+type WindowOpened struct {
+	Id, Class, Title, Workspace string
+}
+
+type WindowClosed struct {
+	Id string
+}
+
+// A window was moved, Workspace is empty if the compositor does not report it
+type WindowMoved struct {
+	Id, Workspace string
+}
+
+type MonitorAdded struct {
+	Name string
+}
+
+type MonitorRemoved struct {
+	Name string
+}
+
+type Urgent struct {
+	Id string
+}
+
+// Fullscreen state changed, Id is empty if the compositor does not report it
+type Fullscreen struct {
+	Id      string
+	Enabled bool
+}
+
+// The keybinding mode (submap in Hyprland) changed
+type ModeChanged struct {
+	Mode string
+}
+
+type Bell struct {
+	Id string
+}
+
+// Windows were moved into or out of a stack (a group in Hyprland). Id is the
+// window that moved, empty when a whole stack was created or dissolved. Not
+// reported by sway, as it has no events for layout changes.
+type StackChanged struct {
+	Id string
+}
+
+func (WorkspaceFocused) is_event() {}
+func (WindowFocused) is_event()    {}
+func (TitleChanged) is_event()     {}
+func (WindowOpened) is_event()     {}
+func (WindowClosed) is_event()     {}
+func (WindowMoved) is_event()      {}
+func (MonitorAdded) is_event()     {}
+func (MonitorRemoved) is_event()   {}
+func (Urgent) is_event()           {}
+func (Fullscreen) is_event()       {}
+func (ModeChanged) is_event()      {}
+func (Bell) is_event()             {}
+func (StackChanged) is_event()     {}
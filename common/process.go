@@ -0,0 +1,81 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var _ = fmt.Print
+
+// LaunchDetached runs the command in a new session, without waiting for it,
+// so that it outlives us
+func LaunchDetached(argv []string) (pid int, err error) {
+	if len(argv) == 0 {
+		return 0, fmt.Errorf("No command specified")
+	}
+	cmd := exec.Command(argv[0], argv[1:]...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err = cmd.Start(); err != nil {
+		return
+	}
+	pid = cmd.Process.Pid
+	err = cmd.Process.Release()
+	return
+}
+
+// parent_pid returns the pid of the parent of the process with the specified
+// pid or zero if it is not known
+func parent_pid(pid int) int {
+	if pid < 1 {
+		return 0
+	}
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// the process name is in parentheses and can contain spaces and
+	// parentheses, so look for the fields after the last closing parenthesis
+	idx := strings.LastIndex(string(data), ") ")
+	if idx < 0 {
+		return 0
+	}
+	// fields after the name are: state ppid ...
+	fields := strings.Fields(string(data)[idx+2:])
+	if len(fields) < 2 {
+		return 0
+	}
+	ppid, err := strconv.Atoi(fields[1])
+	if err != nil || ppid < 1 {
+		return 0
+	}
+	return ppid
+}
+
+// ParentProcessName returns the name of the parent of the process with the
+// specified pid or an empty string if it is not known
+func ParentProcessName(pid int) string {
+	ppid := parent_pid(pid)
+	if ppid < 1 {
+		return ""
+	}
+	name, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", ppid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(name))
+}
+
+// IsDescendantOf returns true if the process with the specified pid is
+// ancestor or one of its descendants
+func IsDescendantOf(pid, ancestor int) bool {
+	for ; pid > 1; pid = parent_pid(pid) {
+		if pid == ancestor {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package common
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestIsDescendantOf(t *testing.T) {
+	pid, ppid := os.Getpid(), os.Getppid()
+	if !IsDescendantOf(pid, pid) || !IsDescendantOf(pid, ppid) {
+		t.Fatalf("Process not a descendant of itself or its parent")
+	}
+	if IsDescendantOf(ppid, pid) || IsDescendantOf(0, pid) {
+		t.Fatalf("Process reported as descendant of its child")
+	}
+}
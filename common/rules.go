@@ -0,0 +1,287 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var _ = fmt.Print
+
+// WindowActions are applied to windows matching a WindowRule
+type WindowActions struct {
+	// Move the window to this workspace, joining its stack if it has one, the
+	// same as MoveToWorkspace
+	Workspace string `json:"workspace,omitempty"`
+	// Make the window floating or tiled
+	Floating *bool `json:"floating,omitempty"`
+	// Resize the window, in pixels
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Make the window fullscreen
+	Fullscreen bool `json:"fullscreen,omitempty"`
+	// Make the window join the stack on its workspace, creating one if the
+	// window is alone on the workspace
+	Stack bool `json:"stack,omitempty"`
+}
+
+func (c WindowActions) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+func (self WindowActions) IsEmpty() bool {
+	return self == WindowActions{}
+}
+
+// merge applies the actions in other on top of these
+func (self *WindowActions) merge(other WindowActions) {
+	if other.Workspace != "" {
+		self.Workspace = other.Workspace
+	}
+	if other.Floating != nil {
+		self.Floating = other.Floating
+	}
+	if other.Width > 0 && other.Height > 0 {
+		self.Width, self.Height = other.Width, other.Height
+	}
+	self.Fullscreen = self.Fullscreen || other.Fullscreen
+	self.Stack = self.Stack || other.Stack
+}
+
+// WindowRule matches windows when they are opened. All specified criteria
+// must match.
+type WindowRule struct {
+	Class, Title, Initial_class, Initial_title *regexp.Regexp
+	// Matched against the name of the parent process of the window's process
+	Parent   *regexp.Regexp
+	Xwayland *bool
+	Actions  WindowActions
+	// Where the rule was defined, for error messages
+	Source string
+}
+
+func (self WindowRule) Matches(w *Window, parent_name func() string) bool {
+	for _, x := range []struct {
+		pat *regexp.Regexp
+		val func() string
+	}{
+		{self.Class, func() string { return w.Class }},
+		{self.Title, func() string { return w.Title }},
+		{self.Initial_class, func() string { return w.Initial_class }},
+		{self.Initial_title, func() string { return w.Initial_title }},
+		{self.Parent, parent_name},
+	} {
+		if x.pat != nil && !x.pat.MatchString(x.val()) {
+			return false
+		}
+	}
+	return self.Xwayland == nil || *self.Xwayland == w.Xwayland
+}
+
+type WindowRules []WindowRule
+
+// ActionsFor returns the actions of all rules matching the window, merged in
+// order, so later rules override earlier ones
+func (self WindowRules) ActionsFor(w *Window) (ans WindowActions, matched bool) {
+	parent := ""
+	parent_looked_up := false
+	parent_name := func() string {
+		if !parent_looked_up {
+			parent, parent_looked_up = ParentProcessName(w.Pid), true
+		}
+		return parent
+	}
+	for _, r := range self {
+		if r.Matches(w, parent_name) {
+			ans.merge(r.Actions)
+			matched = true
+		}
+	}
+	return
+}
+
+func RulesPath() string {
+	return filepath.Join(ConfigDir(), "rules.conf")
+}
+
+// split_fields splits the line at whitespace, text inside double quotes is
+// kept together and can contain backslash escapes
+func split_fields(line string) (ans []string, err error) {
+	current := strings.Builder{}
+	in_field := false
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '"':
+			end := i + 1
+			for ; end < len(line) && line[end] != '"'; end++ {
+				if line[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(line) {
+				return nil, fmt.Errorf("Unterminated quote")
+			}
+			s, qerr := strconv.Unquote(line[i : end+1])
+			if qerr != nil {
+				return nil, fmt.Errorf("Invalid quoted text: %s", line[i:end+1])
+			}
+			current.WriteString(s)
+			in_field, i = true, end
+		case c == ' ' || c == '\t':
+			if in_field {
+				ans = append(ans, current.String())
+				current.Reset()
+				in_field = false
+			}
+		default:
+			current.WriteByte(c)
+			in_field = true
+		}
+	}
+	if in_field {
+		ans = append(ans, current.String())
+	}
+	return
+}
+
+func parse_rule(line string) (ans WindowRule, err error) {
+	fields, err := split_fields(line)
+	if err != nil {
+		return
+	}
+	sep := -1
+	for i, f := range fields {
+		if f == "=>" {
+			sep = i
+			break
+		}
+	}
+	if sep < 1 || sep == len(fields)-1 {
+		return ans, fmt.Errorf("Rules must be of the form: criteria => actions")
+	}
+	for _, f := range fields[:sep] {
+		key, val, found := strings.Cut(f, "=")
+		if !found {
+			return ans, fmt.Errorf("Criteria must be of the form key=value not: %s", f)
+		}
+		var dest **regexp.Regexp
+		switch key {
+		case "class":
+			dest = &ans.Class
+		case "title":
+			dest = &ans.Title
+		case "initial_class":
+			dest = &ans.Initial_class
+		case "initial_title":
+			dest = &ans.Initial_title
+		case "parent":
+			dest = &ans.Parent
+		case "xwayland":
+			b, berr := strconv.ParseBool(val)
+			if berr != nil {
+				return ans, fmt.Errorf("xwayland must be true or false not: %s", val)
+			}
+			ans.Xwayland = &b
+			continue
+		default:
+			return ans, fmt.Errorf("Unknown criteria: %s", key)
+		}
+		if *dest, err = regexp.Compile(val); err != nil {
+			return ans, fmt.Errorf("Invalid regular expression for %s: %w", key, err)
+		}
+	}
+	actions := make([]string, 0, len(fields)-sep)
+	for _, f := range fields[sep+1:] {
+		for _, x := range strings.Split(f, ",") {
+			if x != "" {
+				actions = append(actions, x)
+			}
+		}
+	}
+	a := &ans.Actions
+	for i := 0; i < len(actions); i++ {
+		args := actions[i+1:]
+		switch actions[i] {
+		case "float", "tile":
+			floating := actions[i] == "float"
+			a.Floating = &floating
+		case "fullscreen":
+			a.Fullscreen = true
+		case "stack":
+			a.Stack = true
+		case "workspace":
+			if len(args) < 1 {
+				return ans, fmt.Errorf("The workspace action needs a workspace name")
+			}
+			a.Workspace = args[0]
+			i++
+		case "size":
+			if len(args) < 2 {
+				return ans, fmt.Errorf("The size action needs a width and height")
+			}
+			w, werr := strconv.Atoi(args[0])
+			h, herr := strconv.Atoi(args[1])
+			if werr != nil || herr != nil || w < 1 || h < 1 {
+				return ans, fmt.Errorf("Invalid size: %s %s", args[0], args[1])
+			}
+			a.Width, a.Height = w, h
+			i += 2
+		default:
+			return ans, fmt.Errorf("Unknown action: %s", actions[i])
+		}
+	}
+	return
+}
+
+// ParseRules parses window rules, one per line, of the form:
+//
+//	criteria => actions
+//
+// criteria are key=value pairs, with keys: class, title, initial_class,
+// initial_title and parent whose values are regular expressions and xwayland
+// whose value is true or false. Values containing spaces must be quoted with
+// double quotes. Actions are separated by commas and are: workspace NAME,
+// float, tile, size WIDTH HEIGHT, fullscreen and stack. Blank lines and lines
+// starting with # are ignored.
+func ParseRules(r io.Reader, path string) (ans WindowRules, err error) {
+	scanner := bufio.NewScanner(r)
+	lnum := 0
+	for scanner.Scan() {
+		lnum++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, rerr := parse_rule(line)
+		if rerr != nil {
+			return nil, fmt.Errorf("%w in line %d of %s: %s", rerr, lnum, path, line)
+		}
+		rule.Source = fmt.Sprintf("%s:%d", path, lnum)
+		ans = append(ans, rule)
+	}
+	err = scanner.Err()
+	return
+}
+
+// LoadRules reads the rules file, a missing file has no rules
+func LoadRules() (ans WindowRules, err error) {
+	path := RulesPath()
+	f, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return
+	}
+	defer f.Close()
+	return ParseRules(f, path)
+}
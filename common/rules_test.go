@@ -0,0 +1,56 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestWindowRules(t *testing.T) {
+	rules, err := ParseRules(strings.NewReader(`
+# comment
+class=^thunderbird$ => workspace mail, stack
+class=^mpv$ title="Picture in \"picture\"" => float, size 640 360
+initial_class=^steam xwayland=true => workspace games,fullscreen
+class=^mpv$ => tile
+parent=^no-such-process-name$ => float
+`), "rules.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != 5 || rules[1].Source != "rules.conf:4" {
+		t.Fatalf("Unexpected rules: %v", rules)
+	}
+	tiled := false
+	for _, tc := range []struct {
+		w        Window
+		expected WindowActions
+		matched  bool
+	}{
+		{Window{Class: "thunderbird"}, WindowActions{Workspace: "mail", Stack: true}, true},
+		{Window{Class: "mpv", Title: `Picture in "picture"`}, WindowActions{Floating: &tiled, Width: 640, Height: 360}, true},
+		{Window{Class: "mpv", Title: "movie"}, WindowActions{Floating: &tiled}, true},
+		{Window{Class: "steam_app_1", Initial_class: "steam", Xwayland: true}, WindowActions{Workspace: "games", Fullscreen: true}, true},
+		{Window{Class: "steam", Initial_class: "steam"}, WindowActions{}, false},
+	} {
+		actions, matched := WindowRules(rules).ActionsFor(&tc.w)
+		if matched != tc.matched {
+			t.Fatalf("Unexpected match for %v: %v", tc.w, matched)
+		}
+		if diff := cmp.Diff(tc.expected, actions); diff != "" {
+			t.Fatalf("Unexpected actions for %v:\n%s", tc.w, diff)
+		}
+	}
+	for _, bad := range []string{
+		"class=x", "=> float", "class=x =>", "class=( => float", "colour=red => float", "class=x => explode",
+		"class=x => size 10", "class=x => workspace", `title="x => float`, "xwayland=maybe => float",
+	} {
+		if _, err := ParseRules(strings.NewReader(bad), "rules.conf"); err == nil {
+			t.Fatalf("No error for invalid rule: %s", bad)
+		}
+	}
+}
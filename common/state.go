@@ -0,0 +1,180 @@
+package common
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+)
+
+var _ = fmt.Print
+
+// Compositor independent description of windows, workspaces and outputs.
+// These are what wm query prints, so the JSON names form a stable schema.
+
+type Window struct {
+	// An opaque identifier for the window, the address in Hyprland, the
+	// container id in sway
+	Id    string `json:"id"`
+	Class string `json:"class"`
+	Title string `json:"title"`
+	// The class and title the window had when it was opened
+	Initial_class string `json:"initial_class"`
+	Initial_title string `json:"initial_title"`
+	// True for X11 windows running under Xwayland
+	Xwayland   bool   `json:"xwayland"`
+	Pid        int    `json:"pid"`
+	Workspace  string `json:"workspace"`
+	Output     string `json:"output"`
+	X          int    `json:"x"`
+	Y          int    `json:"y"`
+	Width      int    `json:"width"`
+	Height     int    `json:"height"`
+	Floating   bool   `json:"floating"`
+	Fullscreen bool   `json:"fullscreen"`
+	Focused    bool   `json:"focused"`
+	Urgent     bool   `json:"urgent"`
+	// True for windows that are not shown on any workspace, such as windows
+	// in the sway scratchpad or on hidden Hyprland special workspaces
+	Hidden bool `json:"hidden"`
+	// The position of the window in the focus history, 0 is the most
+	// recently focused window, math.MaxInt for windows never focused
+	Focus_order int `json:"focus_order"`
+	// The ids of all windows in the stack (sway) or group (Hyprland) this
+	// window belongs to, including itself. Empty when not stacked.
+	Stack []string `json:"stack"`
+}
+
+func (c Window) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type Workspace struct {
+	Id      int    `json:"id"`
+	Name    string `json:"name"`
+	Output  string `json:"output"`
+	Focused bool   `json:"focused"`
+	// True if the workspace is currently shown on its output
+	Visible bool `json:"visible"`
+	Windows int  `json:"windows"`
+	// True for Hyprland special workspaces, which are shown on top of other
+	// workspaces
+	Special bool `json:"special"`
+}
+
+func (c Workspace) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type Output struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Make        string  `json:"make"`
+	Model       string  `json:"model"`
+	Serial      string  `json:"serial"`
+	X           int     `json:"x"`
+	Y           int     `json:"y"`
+	Width       int     `json:"width"`
+	Height      int     `json:"height"`
+	Scale       float64 `json:"scale"`
+	// In Hz
+	Refresh_rate      float64 `json:"refresh_rate"`
+	Focused           bool    `json:"focused"`
+	Enabled           bool    `json:"enabled"`
+	Powered           bool    `json:"powered"`
+	Current_workspace string  `json:"current_workspace"`
+}
+
+func (c Output) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+// Matches returns true if the glob pattern matches the name, description,
+// make, model or serial of the output or the make, model and serial separated
+// by spaces, as used by sway to identify outputs
+func (c Output) Matches(pattern string) bool {
+	for _, q := range []string{c.Name, c.Description, c.Make, c.Model, c.Serial, c.Make + " " + c.Model + " " + c.Serial} {
+		if q != "" {
+			if matched, _ := filepath.Match(pattern, q); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// State is a snapshot of the compositor state. Workspaces are in the order
+// the compositor navigates through them.
+type State struct {
+	Windows    []Window    `json:"windows"`
+	Workspaces []Workspace `json:"workspaces"`
+	Outputs    []Output    `json:"outputs"`
+}
+
+// ActiveWindow returns the focused window or nil
+func (self *State) ActiveWindow() *Window {
+	for i := range self.Windows {
+		if self.Windows[i].Focused {
+			return &self.Windows[i]
+		}
+	}
+	return nil
+}
+
+// ActiveWorkspace returns the focused workspace or nil
+func (self *State) ActiveWorkspace() *Workspace {
+	for i := range self.Workspaces {
+		if self.Workspaces[i].Focused {
+			return &self.Workspaces[i]
+		}
+	}
+	return nil
+}
+
+// ActiveOutput returns the focused output or nil
+func (self *State) ActiveOutput() *Output {
+	for i := range self.Outputs {
+		if self.Outputs[i].Focused {
+			return &self.Outputs[i]
+		}
+	}
+	return nil
+}
+
+// OutputInDirection returns the enabled output closest to the specified
+// output in the direction, one of left, right, up or down, or nil
+func (self *State) OutputInDirection(from *Output, direction string) (ans *Output) {
+	center := func(o *Output) (int, int) { return o.X + o.Width/2, o.Y + o.Height/2 }
+	fx, fy := center(from)
+	best := -1
+	for i := range self.Outputs {
+		o := &self.Outputs[i]
+		if o.Name == from.Name || !o.Enabled {
+			continue
+		}
+		x, y := center(o)
+		var along, across int
+		switch direction {
+		case "left":
+			along, across = fx-x, y-fy
+		case "right":
+			along, across = x-fx, y-fy
+		case "up":
+			along, across = fy-y, x-fx
+		case "down":
+			along, across = y-fy, x-fx
+		default:
+			return nil
+		}
+		if along <= 0 {
+			continue
+		}
+		// prefer outputs that are directly in the direction
+		if d := along + 2*max(across, -across); best < 0 || d < best {
+			best, ans = d, o
+		}
+	}
+	return
+}
@@ -0,0 +1,26 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestOutputInDirection(t *testing.T) {
+	state := State{Outputs: []Output{
+		{Name: "laptop", X: 0, Y: 1080, Width: 1920, Height: 1200, Enabled: true},
+		{Name: "left", X: -2560, Y: 0, Width: 2560, Height: 1440, Enabled: true},
+		{Name: "above", X: 0, Y: 0, Width: 1920, Height: 1080, Enabled: true},
+		{Name: "off", X: 1920, Y: 1080, Width: 1920, Height: 1080},
+	}}
+	for direction, expected := range map[string]string{"left": "left", "up": "above", "right": "", "down": ""} {
+		actual := ""
+		if o := state.OutputInDirection(&state.Outputs[0], direction); o != nil {
+			actual = o.Name
+		}
+		if actual != expected {
+			t.Fatalf("Output %s of laptop is %#v instead of %#v", direction, actual, expected)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package common
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+var _ = fmt.Print
+
+// ConnectionState is sent on event streams when the connection to the
+// compositor is lost, with the error that caused it, and again once it has
+// been re-established and the state resynced.
+type ConnectionState struct {
+	Connected bool
+	Err       error
+}
+
+func (ConnectionState) is_event() {}
+
+// Backoff computes exponentially increasing delays between Initial and Max.
+type Backoff struct {
+	Initial, Max time.Duration
+	current      time.Duration
+}
+
+func (self *Backoff) Next() time.Duration {
+	if self.current == 0 {
+		self.current = self.Initial
+	} else {
+		self.current = min(self.current*2, self.Max)
+	}
+	return self.current
+}
+
+func (self *Backoff) Reset() { self.current = 0 }
+
+// EventConnection is a single connection to the event stream of a compositor.
+type EventConnection interface {
+	// Send events describing the current state of the compositor
+	Resync() error
+	// Send events as they arrive until the connection fails or is closed,
+	// returning the error that caused it to stop. No events must be sent
+	// after Run returns. Run is also called after Close, to wait for the
+	// connection to stop sending events, so it must then return promptly.
+	Run() error
+	Close()
+}
+
+// SuperviseEvents connects using connect and returns a channel of the events
+// sent via the send function passed to connect. Whenever the connection fails
+// it is re-established with exponential backoff and the state is resynced.
+// Only the initial connection failure is returned as an error. The channel is
+// closed when ctx is cancelled.
+func SuperviseEvents(ctx context.Context, connect func(send func(Event)) (EventConnection, error)) (<-chan Event, error) {
+	ch := make(chan Event, 64)
+	send := func(ev Event) {
+		select {
+		case ch <- ev:
+		case <-ctx.Done():
+		}
+	}
+	conn, err := connect(send)
+	if err != nil {
+		return nil, err
+	}
+	backoff := Backoff{Initial: 100 * time.Millisecond, Max: 30 * time.Second}
+	run := func(conn EventConnection) (err error) {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Done():
+				conn.Close()
+			case <-stop:
+			}
+		}()
+		defer conn.Close()
+		if err = conn.Resync(); err != nil {
+			// events might still be being sent, wait for them to stop before
+			// the connection is discarded and ch possibly closed
+			conn.Close()
+			conn.Run()
+			return
+		}
+		started := time.Now()
+		err = conn.Run()
+		if time.Since(started) > backoff.Max {
+			backoff.Reset()
+		}
+		return
+	}
+	go func() {
+		defer close(ch)
+		for {
+			err := run(conn)
+			if ctx.Err() != nil {
+				return
+			}
+			send(ConnectionState{Err: err})
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff.Next()):
+				}
+				if conn, err = connect(send); err == nil {
+					break
+				}
+			}
+			send(ConnectionState{Connected: true})
+		}
+	}()
+	return ch, nil
+}
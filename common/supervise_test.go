@@ -0,0 +1,77 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+var _ = fmt.Print
+
+// fake_connection sends events from a goroutine, like the reader goroutines
+// of the real connections, until it is closed
+type fake_connection struct {
+	closed, done chan struct{}
+	close_once   sync.Once
+}
+
+func (self *fake_connection) Resync() error { return errors.New("resync failed") }
+
+func (self *fake_connection) Run() error {
+	<-self.done
+	return errors.New("closed")
+}
+
+func (self *fake_connection) Close() { self.close_once.Do(func() { close(self.closed) }) }
+
+func TestSuperviseEventsResyncFailure(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var lock sync.Mutex
+	var conns []*fake_connection
+	connect := func(send func(Event)) (EventConnection, error) {
+		c := &fake_connection{closed: make(chan struct{}), done: make(chan struct{})}
+		go func() {
+			defer close(c.done)
+			<-c.closed
+			// an event that was being handled when the connection was closed
+			time.Sleep(10 * time.Millisecond)
+			send(ModeChanged{Mode: "late"})
+		}()
+		lock.Lock()
+		conns = append(conns, c)
+		lock.Unlock()
+		return c, nil
+	}
+	events, err := SuperviseEvents(ctx, connect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ev := range events {
+		if cs, ok := ev.(ConnectionState); ok && !cs.Connected {
+			lock.Lock()
+			c, n := conns[len(conns)-1], len(conns)
+			lock.Unlock()
+			select {
+			case <-c.done:
+			default:
+				t.Fatalf("Connection failure reported while the connection is still sending events")
+			}
+			if n > 1 {
+				cancel()
+			}
+		}
+	}
+	lock.Lock()
+	defer lock.Unlock()
+	for _, c := range conns {
+		select {
+		case <-c.done:
+		default:
+			t.Fatalf("Event stream closed while a connection is still sending events")
+		}
+	}
+}
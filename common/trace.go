@@ -0,0 +1,163 @@
+package common
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+var _ = fmt.Print
+
+// The environment variable that names a file to which all IPC with the
+// compositor is logged, same as the --trace-ipc option
+const TRACE_IPC_ENV = "WM_TRACE_IPC"
+
+// IPCTraceRecord is a single message sent to or received from the
+// compositor. Traces are files of these records in JSON lines format.
+type IPCTraceRecord struct {
+	Time time.Time `json:"time"`
+	// sway or hyprland
+	Backend string `json:"backend"`
+	// The socket used, for sway this is always ipc, for Hyprland it is
+	// control or events
+	Socket string `json:"socket"`
+	// Identifies the connection, records with the same value were on the
+	// same connection
+	Conn string `json:"conn"`
+	// send or recv
+	Direction string `json:"dir"`
+	// The i3-ipc message type, only present for sway
+	Type    *uint32 `json:"type,omitempty"`
+	Payload string  `json:"payload"`
+}
+
+var ipc_trace = struct {
+	sync.Mutex
+	initialized bool
+	file        *os.File
+	enc         *json.Encoder
+}{}
+
+// EnableIPCTrace starts logging all IPC to the specified file, appending to
+// it if it already exists.
+func EnableIPCTrace(path string) (err error) {
+	ipc_trace.Lock()
+	defer ipc_trace.Unlock()
+	return enable_ipc_trace(path)
+}
+
+func enable_ipc_trace(path string) (err error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("Failed to open IPC trace file: %w", err)
+	}
+	if ipc_trace.file != nil {
+		ipc_trace.file.Close()
+	}
+	ipc_trace.initialized, ipc_trace.file, ipc_trace.enc = true, f, json.NewEncoder(f)
+	return
+}
+
+// DisableIPCTrace stops logging IPC and closes the trace file
+func DisableIPCTrace() {
+	ipc_trace.Lock()
+	defer ipc_trace.Unlock()
+	if ipc_trace.file != nil {
+		ipc_trace.file.Close()
+	}
+	ipc_trace.initialized, ipc_trace.file, ipc_trace.enc = true, nil, nil
+}
+
+func init_ipc_trace() {
+	if !ipc_trace.initialized {
+		ipc_trace.initialized = true
+		if path := os.Getenv(TRACE_IPC_ENV); path != "" {
+			if err := enable_ipc_trace(path); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+			}
+		}
+	}
+}
+
+// IPCTracing returns true if IPC is being traced, use it to avoid the cost
+// of building records when not tracing. Tracing is enabled either by
+// EnableIPCTrace or by TRACE_IPC_ENV.
+func IPCTracing() bool {
+	ipc_trace.Lock()
+	defer ipc_trace.Unlock()
+	init_ipc_trace()
+	return ipc_trace.enc != nil
+}
+
+// TraceIPC logs the record if tracing is enabled
+func TraceIPC(r IPCTraceRecord) {
+	ipc_trace.Lock()
+	defer ipc_trace.Unlock()
+	init_ipc_trace()
+	if ipc_trace.enc != nil {
+		if r.Time.IsZero() {
+			r.Time = time.Now()
+		}
+		// a single write per record so that concurrent processes appending
+		// to the same file dont interleave records
+		ipc_trace.enc.Encode(r)
+	}
+}
+
+// ReadIPCTrace reads all records from a trace file
+func ReadIPCTrace(path string) (ans []IPCTraceRecord, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for lnum := 1; scanner.Scan(); lnum++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var r IPCTraceRecord
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("Invalid IPC trace record at line %d of %s: %w", lnum, path, err)
+		}
+		ans = append(ans, r)
+	}
+	return ans, scanner.Err()
+}
+
+// IPCExchange is a message sent to the compositor and the response to it
+type IPCExchange struct {
+	Request  IPCTraceRecord
+	Response *IPCTraceRecord
+}
+
+func same_type(a, b *uint32) bool {
+	return a == nil || b == nil || *a == *b
+}
+
+// PairIPCTrace splits the records of a trace into request/response exchanges
+// and unsolicited records, such as events, that are not responses to any
+// request. A response is the first record received on the same connection
+// after a request.
+func PairIPCTrace(records []IPCTraceRecord) (exchanges []IPCExchange, unsolicited []IPCTraceRecord) {
+	waiting := map[string]int{}
+	for _, r := range records {
+		key := r.Backend + ":" + r.Conn
+		if r.Direction == "send" {
+			exchanges = append(exchanges, IPCExchange{Request: r})
+			waiting[key] = len(exchanges)
+			continue
+		}
+		if idx := waiting[key]; idx > 0 && same_type(exchanges[idx-1].Request.Type, r.Type) {
+			exchanges[idx-1].Response = &r
+			delete(waiting, key)
+			continue
+		}
+		unsolicited = append(unsolicited, r)
+	}
+	return
+}
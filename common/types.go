@@ -2,10 +2,32 @@ package common
 
 import (
 	"fmt"
+	"os"
+	"path/filepath"
 )
 
 var _ = fmt.Print
 
+// RuntimeDir returns $XDG_RUNTIME_DIR falling back to /run/user/UID
+func RuntimeDir() string {
+	rdir := os.Getenv("XDG_RUNTIME_DIR")
+	if rdir == "" {
+		rdir = fmt.Sprintf("/run/user/%d", os.Geteuid())
+	}
+	return rdir
+}
+
+// StateDir returns $XDG_STATE_HOME/wm falling back to ~/.local/state/wm, for
+// state that should survive restarts
+func StateDir() string {
+	sdir := os.Getenv("XDG_STATE_HOME")
+	if sdir == "" {
+		home, _ := os.UserHomeDir()
+		sdir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(sdir, "wm")
+}
+
 type WindowRegion struct {
 	X, Y, Width, Height int
 	Label               string
@@ -0,0 +1,100 @@
+package common
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var _ = fmt.Print
+
+// Relative workspace targets accepted in place of a workspace name
+const (
+	WorkspaceNext         = "next"
+	WorkspacePrev         = "prev"
+	WorkspaceNextNonEmpty = "next-nonempty"
+	WorkspacePrevNonEmpty = "prev-nonempty"
+	// The previously focused workspace, this is resolved by the compositor
+	// itself, so it is passed unchanged to ChangeToWorkspace and MoveToWorkspace
+	WorkspaceBackAndForth = "back-and-forth"
+	// The first workspace without windows, or a new one if there is none
+	WorkspaceFirstEmpty = "first-empty"
+	// A new workspace named with the lowest unused number
+	WorkspaceNew = "new"
+)
+
+var WorkspaceTargets = []string{
+	WorkspaceNext, WorkspacePrev, WorkspaceNextNonEmpty, WorkspacePrevNonEmpty, WorkspaceBackAndForth, WorkspaceFirstEmpty, WorkspaceNew}
+
+// new_workspace_name returns the lowest positive number not used by a
+// workspace, either as its name or as the number prefix of a sway style
+// num:name workspace name
+func (self *State) new_workspace_name() string {
+	used := make(map[int]bool, len(self.Workspaces))
+	for _, ws := range self.Workspaces {
+		num, _, _ := strings.Cut(ws.Name, ":")
+		if n, err := strconv.Atoi(num); err == nil {
+			used[n] = true
+		}
+	}
+	for i := 1; ; i++ {
+		if !used[i] {
+			return strconv.Itoa(i)
+		}
+	}
+}
+
+// ResolveWorkspace returns the name of the workspace for the specified
+// target, which is returned unchanged if it is not one of WorkspaceTargets
+// that needs resolving. Workspaces on the output of the focused workspace are
+// considered unless all_outputs is true. An empty name is returned when there
+// is no suitable workspace, for example for next-nonempty when all other
+// workspaces are empty.
+func (self *State) ResolveWorkspace(target string, all_outputs bool) (string, error) {
+	step := 1
+	non_empty := false
+	switch target {
+	case WorkspaceNext:
+	case WorkspacePrev:
+		step = -1
+	case WorkspaceNextNonEmpty:
+		non_empty = true
+	case WorkspacePrevNonEmpty:
+		step, non_empty = -1, true
+	case WorkspaceNew:
+		return self.new_workspace_name(), nil
+	case WorkspaceFirstEmpty:
+	default:
+		return target, nil
+	}
+	active := self.ActiveWorkspace()
+	if active == nil {
+		return "", fmt.Errorf("Could not find the focused workspace")
+	}
+	candidates := make([]Workspace, 0, len(self.Workspaces))
+	for _, ws := range self.Workspaces {
+		if !ws.Special && (all_outputs || ws.Output == active.Output) {
+			candidates = append(candidates, ws)
+		}
+	}
+	if target == WorkspaceFirstEmpty {
+		for _, ws := range candidates {
+			if ws.Windows == 0 {
+				return ws.Name, nil
+			}
+		}
+		return self.new_workspace_name(), nil
+	}
+	idx := slices.IndexFunc(candidates, func(ws Workspace) bool { return ws.Name == active.Name })
+	if idx < 0 {
+		return "", nil
+	}
+	for i := 1; i < len(candidates); i++ {
+		ws := candidates[(idx+i*step+len(candidates))%len(candidates)]
+		if !non_empty || ws.Windows > 0 {
+			return ws.Name, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,59 @@
+package common
+
+import (
+	"fmt"
+	"testing"
+)
+
+var _ = fmt.Print
+
+func TestResolveWorkspace(t *testing.T) {
+	state := State{Workspaces: []Workspace{
+		{Name: "1", Output: "A", Windows: 2},
+		{Name: "2", Output: "A", Focused: true, Visible: true, Windows: 1},
+		{Name: "3", Output: "A"},
+		{Name: "mail", Output: "B", Visible: true, Windows: 1},
+		{Name: "5", Output: "A", Windows: 3},
+		{Name: "special:term", Output: "A", Windows: 1, Special: true},
+	}}
+	for _, tc := range []struct {
+		target      string
+		all_outputs bool
+		expected    string
+	}{
+		{"next", false, "3"},
+		{"prev", false, "1"},
+		{"next-nonempty", false, "5"},
+		{"prev-nonempty", false, "1"},
+		{"next-nonempty", true, "mail"},
+		{"first-empty", false, "3"},
+		{"new", false, "4"},
+		{"back-and-forth", false, "back-and-forth"},
+		{"mail", false, "mail"},
+	} {
+		if actual, err := state.ResolveWorkspace(tc.target, tc.all_outputs); err != nil || actual != tc.expected {
+			t.Fatalf("Resolving %#v (all outputs: %v) gave %#v instead of %#v, error: %v", tc.target, tc.all_outputs, actual, tc.expected, err)
+		}
+	}
+	// wrapping around and skipping empty workspaces
+	state.Workspaces[1].Focused, state.Workspaces[4].Focused = false, true
+	for target, expected := range map[string]string{"next": "1", "next-nonempty": "1", "prev-nonempty": "2", "prev": "3"} {
+		if actual, _ := state.ResolveWorkspace(target, false); actual != expected {
+			t.Fatalf("Resolving %#v gave %#v instead of %#v", target, actual, expected)
+		}
+	}
+	// no other non-empty workspace
+	state.Workspaces = []Workspace{{Name: "1", Output: "A", Focused: true, Windows: 1}, {Name: "2", Output: "A"}}
+	if actual, err := state.ResolveWorkspace("next-nonempty", false); err != nil || actual != "" {
+		t.Fatalf("Unexpected resolution: %#v error: %v", actual, err)
+	}
+	state.Workspaces[0].Windows = 0
+	if actual, _ := state.ResolveWorkspace("first-empty", false); actual != "1" {
+		t.Fatalf("Unexpected first empty workspace: %#v", actual)
+	}
+	// sway style num:name workspace names use their number
+	state.Workspaces = []Workspace{{Name: "1:web", Output: "A", Focused: true, Windows: 1}, {Name: "2", Output: "A", Windows: 1}, {Name: "x:3", Output: "A"}}
+	if actual, _ := state.ResolveWorkspace("new", false); actual != "3" {
+		t.Fatalf("Unexpected new workspace: %#v", actual)
+	}
+}
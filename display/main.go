@@ -6,8 +6,7 @@ import (
 	"os/exec"
 	"strconv"
 	"strings"
-	"wm/hypr"
-	"wm/sway"
+	"wm/common"
 
 	"github.com/kovidgoyal/kitty/tools/cli"
 	"github.com/kovidgoyal/kitty/tools/utils"
@@ -16,15 +15,11 @@ import (
 var _ = fmt.Print
 
 func change_power(action string) (err error) {
-	switch {
-	case sway.IsSwayRunning():
-		err = sway.TogglePower(action, "*")
-	case hypr.IsHyprlandRunning():
-		err = hypr.TogglePower(action, "*")
-	default:
-		err = fmt.Errorf("No supported Wayland compositor is running")
+	var c common.Compositor
+	if c, err = common.DetectCompositor(); err != nil {
+		return
 	}
-	return
+	return c.TogglePower(action, "*")
 }
 
 func change_brightness(brighter bool) (err error) {
@@ -0,0 +1,133 @@
+package focus
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/cli"
+)
+
+var _ = fmt.Print
+
+type options struct {
+	Class, Title, Workspace string
+	Pid                     int
+}
+
+func (self options) criteria() (ans common.WindowCriteria, err error) {
+	if ans, err = common.NewWindowCriteria(self.Class, self.Title, self.Pid, self.Workspace); err == nil && ans.IsEmpty() {
+		err = fmt.Errorf("No criteria specified, use at least one of --class, --title, --pid or --workspace")
+	}
+	return
+}
+
+func add_criteria_options(cmd *cli.Command) {
+	cmd.Add(cli.OptionSpec{Name: "--class", Help: "A regular expression matched against the window class (app_id in sway)"})
+	cmd.Add(cli.OptionSpec{Name: "--title", Help: "A regular expression matched against the window title"})
+	cmd.Add(cli.OptionSpec{Name: "--pid", Type: "int", Default: "0", Help: "The process id of the window"})
+	cmd.Add(cli.OptionSpec{Name: "--workspace", Help: "The name of the workspace the window is on"})
+}
+
+// most_recent returns the most recently focused of the windows or nil
+func most_recent(windows []common.Window) *common.Window {
+	if len(windows) == 0 {
+		return nil
+	}
+	w := slices.MinFunc(windows, func(a, b common.Window) int { return cmp.Compare(a.Focus_order, b.Focus_order) })
+	return &w
+}
+
+// next_match returns the window to focus from the matching windows for
+// run-or-raise. If the focused window is one of them, the next one is chosen,
+// so that repeated invocations cycle through them, otherwise the most
+// recently focused one.
+func next_match(matches []common.Window) *common.Window {
+	if idx := slices.IndexFunc(matches, func(w common.Window) bool { return w.Focused }); idx > -1 {
+		if len(matches) == 1 {
+			return nil
+		}
+		return &matches[(idx+1)%len(matches)]
+	}
+	return most_recent(matches)
+}
+
+func get_state(opts options) (c common.Compositor, matches []common.Window, err error) {
+	var criteria common.WindowCriteria
+	if criteria, err = opts.criteria(); err != nil {
+		return
+	}
+	if c, err = common.DetectCompositor(); err != nil {
+		return
+	}
+	var state common.State
+	if state, err = c.GetState(); err != nil {
+		return
+	}
+	return c, state.Matching(criteria), nil
+}
+
+func focus(opts options) (rc int, err error) {
+	c, matches, err := get_state(opts)
+	if err != nil {
+		return 1, err
+	}
+	w := most_recent(matches)
+	if w == nil {
+		return 1, nil
+	}
+	if !w.Focused {
+		err = c.FocusWindow(w.Id)
+	}
+	return
+}
+
+func run_or_raise(opts options, argv []string) (rc int, err error) {
+	c, matches, err := get_state(opts)
+	if err != nil {
+		return 1, err
+	}
+	if len(matches) == 0 {
+		_, err = common.LaunchDetached(argv)
+	} else if w := next_match(matches); w != nil {
+		err = c.FocusWindow(w.Id)
+	}
+	return
+}
+
+func AddEntryPoints(root *cli.Command) {
+	add_criteria_options(root.AddSubCommand(&cli.Command{
+		Name:             "focus",
+		ShortDescription: "Focus the most recently used window matching the specified criteria",
+		HelpText:         "All specified criteria must match. Exits with status 1 if no window matches.",
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			var opts options
+			if err = cmd.GetOptionValues(&opts); err != nil {
+				return 1, err
+			}
+			if len(args) != 0 {
+				cmd.ShowHelp()
+				return 1, nil
+			}
+			return focus(opts)
+		},
+	}))
+	add_criteria_options(root.AddSubCommand(&cli.Command{
+		Name:             "run-or-raise",
+		Usage:            "[criteria options] -- command [args...]",
+		ShortDescription: "Focus a window matching the criteria, running the command if there is none",
+		HelpText:         "If no window matches the criteria, the command is run. Otherwise the most recently used matching window is focused, and if a matching window is already focused the next matching window is focused instead, so that repeated invocations cycle through all matching windows.",
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			var opts options
+			if err = cmd.GetOptionValues(&opts); err != nil {
+				return 1, err
+			}
+			if len(args) == 0 {
+				cmd.ShowHelp()
+				return 1, nil
+			}
+			return run_or_raise(opts, args)
+		},
+	}))
+}
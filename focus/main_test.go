@@ -0,0 +1,69 @@
+package focus
+
+import (
+	"fmt"
+	"testing"
+	"wm/common"
+)
+
+var _ = fmt.Print
+
+func TestWindowSelection(t *testing.T) {
+	state := common.State{Windows: []common.Window{
+		{Id: "1", Class: "kitty", Title: "vim", Focus_order: 2},
+		{Id: "2", Class: "firefox", Title: "Mozilla Firefox", Focus_order: 0, Focused: true},
+		{Id: "3", Class: "kitty", Title: "shell", Focus_order: 1},
+		{Id: "4", Class: "kitty-like", Title: "other", Focus_order: 3, Workspace: "2"},
+	}}
+	matching := func(class, title, workspace string) []common.Window {
+		t.Helper()
+		c, err := common.NewWindowCriteria(class, title, 0, workspace)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return state.Matching(c)
+	}
+	id := func(w *common.Window) string {
+		if w == nil {
+			return ""
+		}
+		return w.Id
+	}
+	if got := id(most_recent(matching("^kitty$", "", ""))); got != "3" {
+		t.Fatalf("Unexpected most recent window: %s", got)
+	}
+	if got := id(most_recent(matching("kitty", "", "2"))); got != "4" {
+		t.Fatalf("Unexpected most recent window: %s", got)
+	}
+	if got := id(most_recent(matching("nothing", "", ""))); got != "" {
+		t.Fatalf("Unexpected most recent window: %s", got)
+	}
+	// not focused, so raise the most recent match
+	if got := id(next_match(matching("kitty", "", ""))); got != "3" {
+		t.Fatalf("Unexpected window to raise: %s", got)
+	}
+	// cycle through matches when one is focused
+	state.Windows[1].Focused, state.Windows[2].Focused = false, true
+	for _, expected := range []string{"4", "1", "3"} {
+		got := id(next_match(matching("kitty", "", "")))
+		if got != expected {
+			t.Fatalf("Unexpected window when cycling: %s != %s", got, expected)
+		}
+		for i := range state.Windows {
+			state.Windows[i].Focused = state.Windows[i].Id == got
+		}
+	}
+	// a single focused match has nothing to cycle to
+	for i := range state.Windows {
+		state.Windows[i].Focused = state.Windows[i].Id == "2"
+	}
+	if got := id(next_match(matching("", "Firefox", ""))); got != "" {
+		t.Fatalf("Unexpected window when cycling single match: %s", got)
+	}
+	if _, err := (options{}).criteria(); err == nil {
+		t.Fatal("No error for empty criteria")
+	}
+	if _, err := (options{Class: "("}).criteria(); err == nil {
+		t.Fatal("No error for invalid regex")
+	}
+}
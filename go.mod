@@ -6,6 +6,7 @@ go 1.26.0
 //replace github.com/kovidgoyal/kitty => ../kitty
 
 require (
+	github.com/google/go-cmp v0.7.0
 	github.com/kovidgoyal/kitty v0.0.0-00010101000000-000000000000
 	golang.org/x/sys v0.46.0
 )
@@ -15,7 +16,6 @@ require (
 	github.com/ebitengine/purego v0.10.1 // indirect
 	github.com/emmansun/base64 v0.9.0 // indirect
 	github.com/go-ole/go-ole v1.2.6 // indirect
-	github.com/google/go-cmp v0.7.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
 	github.com/kovidgoyal/go-parallel v1.1.1 // indirect
 	github.com/kovidgoyal/go-shm v1.0.0 // indirect
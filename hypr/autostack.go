@@ -0,0 +1,121 @@
+package hypr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// Workspaces stacked by ToggleStack are remembered so that the auto stack
+// daemon can move windows arriving in them into their stack. They are kept
+// by name, which unlike ids are stable across Hyprland restarts.
+
+func stacked_workspaces_path() string {
+	return filepath.Join(common.StateDir(), "hypr-stacked-workspaces.json")
+}
+
+func load_stacked_workspaces() *utils.Set[string] {
+	var names []string
+	if data, err := os.ReadFile(stacked_workspaces_path()); err == nil {
+		if err = json.Unmarshal(data, &names); err != nil {
+			names = nil
+		}
+	}
+	ans := utils.NewSet[string](len(names))
+	ans.AddItems(names...)
+	return ans
+}
+
+func set_workspace_stacked(name string, stacked bool) error {
+	s := load_stacked_workspaces()
+	if s.Has(name) == stacked {
+		return nil
+	}
+	if stacked {
+		s.Add(name)
+	} else {
+		s.Discard(name)
+	}
+	names := s.AsSlice()
+	slices.Sort(names)
+	data, _ := json.Marshal(names)
+	path := stacked_workspaces_path()
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o600)
+}
+
+// auto_stack_window moves the window into the stack of its workspace if the
+// workspace is in stack mode
+func auto_stack_window(addr string) (err error) {
+	stacked := load_stacked_workspaces()
+	if stacked.Len() == 0 {
+		return
+	}
+	var workspaces []Workspace
+	var active_workspace Workspace
+	var windows []Window
+	if err = make_requests(request{"workspaces", &workspaces}, request{"activeworkspace", &active_workspace}, request{"clients", &windows}); err != nil {
+		return
+	}
+	idx := slices.IndexFunc(windows, func(w Window) bool { return w.Address == addr })
+	if idx < 0 {
+		return
+	}
+	window := windows[idx]
+	if window.Floating || len(window.Grouped) > 0 || !stacked.Has(window.Workspace.Name) {
+		return
+	}
+	if !slices.ContainsFunc(windows, func(w Window) bool {
+		return w.Workspace.Id == window.Workspace.Id && w.Address != window.Address && len(w.Grouped) > 0
+	}) {
+		// the stack is gone, either the workspace was destroyed or its group
+		// was dissolved, so stop stacking instead of making a new group
+		return set_workspace_stacked(window.Workspace.Name, false)
+	}
+	for _, ws := range workspaces {
+		if ws.Id == window.Workspace.Id {
+			if cmds := join_stack(window, ws, windows, active_workspace.Name); len(cmds) > 0 {
+				err = dispatch_commands(cmds...)
+			}
+			break
+		}
+	}
+	return
+}
+
+// AutoStack moves windows opened in or moved to workspaces stacked by
+// ToggleStack into their stack, until ctx is cancelled
+func AutoStack(ctx context.Context) (err error) {
+	events, err := Subscribe(ctx)
+	if err != nil {
+		return
+	}
+	for ev := range events {
+		var addr, ws string
+		switch e := ev.(type) {
+		case common.WindowOpened:
+			addr, ws = e.Id, e.Workspace
+		case common.WindowMoved:
+			addr, ws = e.Id, e.Workspace
+		default:
+			continue
+		}
+		if ws != "" && !load_stacked_workspaces().Has(ws) {
+			continue
+		}
+		if err := auto_stack_window(addr); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to move the window %s into the stack of its workspace: %s\n", addr, err)
+		}
+	}
+	return
+}
@@ -0,0 +1,249 @@
+package hypr
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// CommandError is the failure of a single command in a batch
+type CommandError struct {
+	Command, Response string
+	// True when Hyprland did not recognize the command at all, typically
+	// because it is too old or too new for the syntax used
+	Unknown_request bool
+	// Set when the response could not be decoded
+	Err error
+}
+
+func (e *CommandError) Error() string {
+	switch {
+	case e.Unknown_request:
+		return fmt.Sprintf("The Hyprland command: %s is not supported by the running Hyprland", e.Command)
+	case e.Err != nil:
+		return fmt.Sprintf("The Hyprland command: %s returned an invalid response: %s", e.Command, e.Err)
+	case e.Response == "":
+		return fmt.Sprintf("The Hyprland command: %s got no response", e.Command)
+	}
+	return fmt.Sprintf("The Hyprland command: %s returned an error response: %s", e.Command, e.Response)
+}
+
+func (e *CommandError) Unwrap() error { return e.Err }
+
+// CommandErrors is the list of failed commands in a batch, in order
+type CommandErrors []*CommandError
+
+func (e CommandErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, x := range e {
+		msgs[i] = x.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+func (e CommandErrors) Unwrap() []error {
+	ans := make([]error, len(e))
+	for i, x := range e {
+		ans[i] = x
+	}
+	return ans
+}
+
+type batch_item struct {
+	cmd      string
+	response any
+	dispatch *DispatchCommand
+}
+
+// Batch is a list of queries and commands to send to Hyprland in a single request
+type Batch struct {
+	items []batch_item
+}
+
+// Query adds a JSON query such as clients or activewindow, the reply is
+// decoded into response
+func (self *Batch) Query(cmd string, response any) *Batch {
+	self.items = append(self.items, batch_item{cmd: cmd, response: response})
+	return self
+}
+
+// Command adds raw commands whose expected reply is ok
+func (self *Batch) Command(cmds ...string) *Batch {
+	for _, cmd := range cmds {
+		self.items = append(self.items, batch_item{cmd: cmd})
+	}
+	return self
+}
+
+// Dispatch adds dispatchers, rendered in the syntax the running Hyprland understands
+func (self *Batch) Dispatch(cmds ...DispatchCommand) *Batch {
+	for _, cmd := range cmds {
+		self.items = append(self.items, batch_item{dispatch: &cmd})
+	}
+	return self
+}
+
+func (self *Batch) Len() int { return len(self.items) }
+
+// Client sends requests to the Hyprland control socket. Hyprland replies to
+// a single request per connection and then closes it, so rather than keeping
+// a connection open the client sends each Batch as one [[BATCH]] request over
+// a fresh connection.
+type Client struct {
+	socket_path string
+	// Used for requests whose context has no deadline, zero means no timeout
+	Timeout time.Duration
+}
+
+func NewClient() (*Client, error) {
+	rdir := RuntimeDir()
+	if rdir == "" {
+		return nil, fmt.Errorf("The Hyprland compositor does not seem to be running, could not find its socket")
+	}
+	return &Client{socket_path: filepath.Join(rdir, ".socket.sock"), Timeout: 10 * time.Second}, nil
+}
+
+// Capabilities returns the cached capabilities of the running Hyprland, see GetCapabilities
+func (self *Client) Capabilities(ctx context.Context) (ans Capabilities, err error) {
+	return get_capabilities(filepath.Dir(self.socket_path), func() (v Version, err error) {
+		err = self.Run(ctx, new(Batch).Query("version", &v))
+		return
+	})
+}
+
+func (self *Client) roundtrip(ctx context.Context, payload string) (data []byte, err error) {
+	if _, has_deadline := ctx.Deadline(); !has_deadline && self.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, self.Timeout)
+		defer cancel()
+	}
+	var conn net.Conn
+	if conn, err = (&net.Dialer{}).DialContext(ctx, "unix", self.socket_path); err != nil {
+		return
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	// unblock reads and writes if the context is cancelled
+	stop := context.AfterFunc(ctx, func() { conn.SetDeadline(time.Unix(1, 0)) })
+	defer stop()
+	defer func() {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// the connection deadline is only ever set from the context,
+			// wait for the context to notice
+			<-ctx.Done()
+		}
+		if err != nil && ctx.Err() != nil {
+			err = fmt.Errorf("Request to Hyprland failed: %w", ctx.Err())
+		}
+	}()
+	trace(conn, "control", "send", payload)
+	if _, err = conn.Write(utils.UnsafeStringToBytes(payload)); err != nil {
+		return
+	}
+	if data, err = io.ReadAll(conn); err == nil {
+		trace(conn, "control", "recv", string(data))
+	}
+	return
+}
+
+func trace(conn net.Conn, socket, direction, payload string) {
+	if common.IPCTracing() {
+		common.TraceIPC(common.IPCTraceRecord{Backend: "hyprland", Socket: socket, Conn: fmt.Sprintf("%p", conn), Direction: direction, Payload: payload})
+	}
+}
+
+// Run sends all items in the batch to Hyprland in a single request. Replies
+// to queries are decoded into their response values. The returned error is
+// a CommandErrors listing every item that failed, or an error if Hyprland
+// could not be contacted at all.
+func (self *Client) Run(ctx context.Context, batch *Batch) (err error) {
+	if batch.Len() == 0 {
+		return
+	}
+	type sent struct {
+		cmd  string
+		item *batch_item
+	}
+	var caps Capabilities
+	have_caps := false
+	commands := make([]sent, 0, batch.Len())
+	for i := range batch.items {
+		item := &batch.items[i]
+		if item.dispatch == nil {
+			commands = append(commands, sent{item.cmd, item})
+			continue
+		}
+		if !have_caps {
+			if caps, err = self.Capabilities(ctx); err != nil {
+				return
+			}
+			have_caps = true
+		}
+		var rendered []string
+		if rendered, err = item.dispatch.Render(caps); err != nil {
+			return
+		}
+		for _, cmd := range rendered {
+			commands = append(commands, sent{cmd, item})
+		}
+	}
+	q := strings.Builder{}
+	q.WriteString("[[BATCH]]")
+	for _, c := range commands {
+		q.WriteString("j/")
+		q.WriteString(c.cmd)
+		q.WriteString(";")
+	}
+	var data []byte
+	if data, err = self.roundtrip(ctx, q.String()); err != nil {
+		return
+	}
+	var errs CommandErrors
+	for _, c := range commands {
+		pos := bytes.Index(data, []byte{'\n', '\n', '\n'})
+		chunk := utils.IfElse(pos < 0, data, data[:max(0, pos)])
+		data = data[utils.IfElse(pos < 0, len(data), pos+3):]
+		response := strings.TrimSpace(string(chunk))
+		cerr := &CommandError{Command: c.cmd, Response: response}
+		switch {
+		case response == "unknown request":
+			cerr.Unknown_request = true
+		case c.item.response != nil:
+			if strings.HasPrefix(response, "{") || strings.HasPrefix(response, "[") {
+				if cerr.Err = json.Unmarshal(chunk, c.item.response); cerr.Err == nil {
+					continue
+				}
+			}
+		case response == "ok":
+			continue
+		}
+		errs = append(errs, cerr)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func run_batch(batch *Batch) (err error) {
+	var c *Client
+	if c, err = NewClient(); err != nil {
+		return
+	}
+	return c.Run(context.Background(), batch)
+}
@@ -0,0 +1,123 @@
+package hypr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestClientMixedBatch(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("firefox", "two", "1")
+	h.focus(a.Address)
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var before, after Window
+	var clients []Window
+	batch := new(Batch).Query("activewindow", &before).Dispatch(Dispatch.Focus(WindowAddress(b.Address))).Query("activewindow", &after).Query("clients", &clients)
+	if err = c.Run(context.Background(), batch); err != nil {
+		t.Fatal(err)
+	}
+	if before.Address != a.Address || after.Address != b.Address || len(clients) != 2 {
+		t.Fatalf("Unexpected responses: before: %s after: %s clients: %d", before.Address, after.Address, len(clients))
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w Window
+	var ws Workspace
+	batch := new(Batch).Command("bogus").Dispatch(Dispatch.Focus(WindowAddress("0xdead")), Dispatch.Focus(WindowAddress(a.Address))).Query("nonsense", &ws).Query("activewindow", &w)
+	err = c.Run(context.Background(), batch)
+	var errs CommandErrors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	type summary struct {
+		Command, Response string
+		Unknown_request   bool
+	}
+	var actual []summary
+	for _, e := range errs {
+		actual = append(actual, summary{e.Command, e.Response, e.Unknown_request})
+	}
+	lua, lerr := Dispatch.Focus(WindowAddress("0xdead")).Lua()
+	if lerr != nil {
+		t.Fatal(lerr)
+	}
+	expected := []summary{
+		{"bogus", "unknown request", true},
+		{"eval " + lua, "window not found", false},
+		{"nonsense", "unknown request", true},
+	}
+	if diff := cmp.Diff(expected, actual); diff != "" {
+		t.Fatalf("Unexpected errors:\n%s", diff)
+	}
+	// the other items in the batch still succeed
+	if w.Address != a.Address {
+		t.Fatalf("Query in failed batch not decoded: %s", w)
+	}
+	var ce *CommandError
+	if !errors.As(err, &ce) || ce.Command != "bogus" {
+		t.Fatalf("errors.As did not find the first command error: %v", ce)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	h := new_fake_hyprland(t)
+	h.lock.Lock()
+	h.stall = true
+	h.lock.Unlock()
+	c, err := NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var w Window
+	start := time.Now()
+	err = c.Run(ctx, new(Batch).Query("activewindow", &w))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Fatalf("Timeout not respected")
+	}
+	c.Timeout = 50 * time.Millisecond
+	if err = c.Run(context.Background(), new(Batch).Query("activewindow", &w)); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Unexpected error with default timeout: %v", err)
+	}
+}
+
+func TestToggleStackConnections(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	h.add_window("kitty", "two", "1")
+	h.focus(a.Address)
+	for range 2 {
+		if err := ToggleStack(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	// version query, state query, group + clients, move + clients,
+	// focus, state query, move out of group + clients, ungroup + resize
+	if h.connections != 8 {
+		t.Fatalf("Unexpected number of connections: %d", h.connections)
+	}
+}
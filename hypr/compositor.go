@@ -0,0 +1,50 @@
+package hypr
+
+import (
+	"context"
+	"fmt"
+	"wm/common"
+)
+
+var _ = fmt.Print
+
+type Hyprland struct{}
+
+func (Hyprland) Name() string       { return "Hyprland" }
+func (Hyprland) InstanceID() string { return RuntimeDir() }
+
+func (Hyprland) ChangeToWorkspace(name string) error  { return ChangeToWorkspace(name) }
+func (Hyprland) MoveToWorkspace(name string) error    { return MoveToWorkspace(name) }
+func (Hyprland) BringWorkspaceHere(name string) error { return BringWorkspaceHere(name) }
+func (Hyprland) ToggleStack() error                   { return ToggleStack() }
+func (Hyprland) SuperTab() error                      { return SuperTab() }
+
+func (Hyprland) GetWindowRegions() ([]common.WindowRegion, error) { return GetWindowRegions() }
+func (Hyprland) GetState() (common.State, error)                  { return GetState() }
+func (Hyprland) FocusedStack() ([]common.Window, error)           { return FocusedStack() }
+func (Hyprland) FocusWindow(id string) error                      { return FocusWindow(id) }
+func (Hyprland) ToggleScratchpad(name, window_id string) error {
+	return ToggleScratchpad(name, window_id)
+}
+
+func (Hyprland) ApplyWindowActions(id string, actions common.WindowActions) error {
+	return ApplyWindowActions(id, actions)
+}
+
+func (Hyprland) MoveWorkspaceToOutput(workspace, output string) error {
+	return MoveWorkspaceToOutput(workspace, output)
+}
+
+func (Hyprland) TogglePower(action, output_name_glob string) error {
+	return TogglePower(action, output_name_glob)
+}
+
+func (Hyprland) Exit() error                       { return ExitHyprland() }
+func (Hyprland) GetPIDsForGracefulShutdown() []int { return GetPIDsForGracefulShutdown() }
+
+func (Hyprland) AutoStack(ctx context.Context) error                        { return AutoStack(ctx) }
+func (Hyprland) Subscribe(ctx context.Context) (<-chan common.Event, error) { return Subscribe(ctx) }
+
+func init() {
+	common.RegisterCompositor("Hyprland", IsHyprlandRunning, func() common.Compositor { return Hyprland{} })
+}
@@ -0,0 +1,379 @@
+package hypr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// Building of Lua dispatch expressions, see hl.dsp in the Hyprland Lua API {{{
+
+// lua_quote returns s as a double quoted Lua string literal
+func lua_quote(s string) string {
+	b := strings.Builder{}
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			// escape ; as it is the separator for batched control socket requests
+			if c < 32 || c == 127 || c == ';' {
+				// always use three digits so a following digit is not consumed
+				fmt.Fprintf(&b, `\%03d`, c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func lua_value(v any) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return lua_quote(v), nil
+	case WindowSelector:
+		return lua_quote(string(v)), nil
+	case WorkspaceSelector:
+		return lua_quote(string(v)), nil
+	case Direction:
+		return lua_quote(string(v)), nil
+	case bool:
+		return strconv.FormatBool(v), nil
+	case int:
+		return strconv.Itoa(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	default:
+		return "", fmt.Errorf("Unsupported Lua value type: %T", v)
+	}
+}
+
+// DispatchArg is a single key = value entry in the table of arguments passed
+// to a dispatcher
+type DispatchArg struct {
+	Key   string
+	Value any
+}
+
+// DispatchCommand is an invocation of a Hyprland dispatcher
+type DispatchCommand struct {
+	// The name of the dispatcher in hl.dsp, for example: window.move
+	Name string
+	Args []DispatchArg
+	// Positional arguments, used by dispatchers that dont take a table
+	Positional []any
+}
+
+// Lua returns the Lua expression that invokes the dispatcher
+func (self DispatchCommand) Lua() (string, error) {
+	b := strings.Builder{}
+	b.WriteString("hl.dispatch(hl.dsp.")
+	b.WriteString(self.Name)
+	b.WriteByte('(')
+	for i, v := range self.Positional {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		val, err := lua_value(v)
+		if err != nil {
+			return "", fmt.Errorf("%w in the arguments of %s", err, self.Name)
+		}
+		b.WriteString(val)
+	}
+	if len(self.Args) > 0 {
+		b.WriteString("{ ")
+		for i, a := range self.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			val, err := lua_value(a.Value)
+			if err != nil {
+				return "", fmt.Errorf("%w for %s in the arguments of %s", err, a.Key, self.Name)
+			}
+			b.WriteString(a.Key)
+			b.WriteString(" = ")
+			b.WriteString(val)
+		}
+		b.WriteString(" }")
+	}
+	b.WriteString("))")
+	return b.String(), nil
+}
+
+// String describes the dispatcher for debugging, the result must not be sent
+// to Hyprland as it is a description of the error if the dispatcher cannot be
+// rendered. Use Render(), Lua() or Legacy() to get the commands to send.
+func (self DispatchCommand) String() string {
+	lua, err := self.Lua()
+	if err != nil {
+		return fmt.Sprintf("<invalid dispatch: %s>", err)
+	}
+	return "eval " + lua
+}
+
+func (self DispatchCommand) arg(key string) string {
+	for _, a := range self.Args {
+		if a.Key == key {
+			return fmt.Sprint(a.Value)
+		}
+	}
+	return ""
+}
+
+// Legacy returns the commands using the classic dispatcher syntax, for
+// example: dispatch focuswindow address:0x1. Some dispatchers only act on the
+// active window in this syntax, for those the window is focused first.
+func (self DispatchCommand) Legacy() (ans []string, err error) {
+	for _, a := range self.Args {
+		// the classic syntax has no quoting
+		if s := fmt.Sprint(a.Value); strings.ContainsAny(s, ";\n") {
+			return nil, fmt.Errorf("The value %#v for %s cannot be used with the classic Hyprland dispatcher syntax", s, a.Key)
+		}
+	}
+	window := self.arg("window")
+	on_window := func(cmd string) {
+		if window != "" {
+			ans = append(ans, "dispatch focuswindow "+window)
+		}
+		ans = append(ans, "dispatch "+cmd)
+	}
+	with_window_arg := func(cmd string) string {
+		return cmd + utils.IfElse(window == "", "", " "+window)
+	}
+	switch self.Name {
+	case "focus":
+		switch {
+		case self.arg("workspace") != "" && self.arg("on_current_monitor") == "true":
+			ans = append(ans, "dispatch focusworkspaceoncurrentmonitor "+self.arg("workspace"))
+		case self.arg("workspace") != "":
+			ans = append(ans, "dispatch workspace "+self.arg("workspace"))
+		case self.arg("direction") != "":
+			ans = append(ans, "dispatch movefocus "+self.arg("direction"))
+		default:
+			ans = append(ans, "dispatch focuswindow "+window)
+		}
+	case "window.move":
+		switch {
+		case self.arg("workspace") != "":
+			cmd := utils.IfElse(self.arg("silent") == "true", "movetoworkspacesilent ", "movetoworkspace ") + self.arg("workspace")
+			ans = append(ans, "dispatch "+cmd+utils.IfElse(window == "", "", ","+window))
+		case self.arg("out_of_group") != "":
+			ans = append(ans, "dispatch "+with_window_arg("moveoutofgroup"))
+		default:
+			on_window(utils.IfElse(self.arg("group_aware") == "true", "movewindoworgroup ", "movewindow ") + self.arg("direction"))
+		}
+	case "group.toggle":
+		on_window("togglegroup")
+	case "group.next":
+		ans = append(ans, "dispatch changegroupactive f")
+	case "group.prev":
+		ans = append(ans, "dispatch changegroupactive b")
+	case "window.cycle_next":
+		ans = append(ans, "dispatch cyclenext")
+	case "window.cycle_prev":
+		ans = append(ans, "dispatch cyclenext prev")
+	case "window.close":
+		ans = append(ans, utils.IfElse(window == "", "dispatch killactive", "dispatch closewindow "+window))
+	case "window.float":
+		ans = append(ans, "dispatch "+with_window_arg("togglefloating"))
+	case "window.fullscreen":
+		on_window("fullscreen 0")
+	case "window.resize":
+		ans = append(ans, "dispatch resizewindowpixel exact "+self.arg("x")+" "+self.arg("y")+utils.IfElse(window == "", "", ","+window))
+	case "window.pin":
+		ans = append(ans, "dispatch "+with_window_arg("pin"))
+	case "workspace.move":
+		ans = append(ans, "dispatch moveworkspacetomonitor "+self.arg("workspace")+" "+self.arg("monitor"))
+	case "workspace.toggle_special":
+		ans = append(ans, "dispatch togglespecialworkspace "+self.arg("name"))
+	case "dpms":
+		ans = append(ans, "dispatch dpms "+self.arg("action")+" "+self.arg("monitor"))
+	case "exec_cmd":
+		cmdline := fmt.Sprint(self.Positional[0])
+		if strings.ContainsAny(cmdline, ";\n") {
+			return nil, fmt.Errorf("The command line %#v cannot be used with the classic Hyprland dispatcher syntax", cmdline)
+		}
+		ans = append(ans, "dispatch exec "+cmdline)
+	case "exit":
+		ans = append(ans, "dispatch exit")
+	default:
+		return nil, fmt.Errorf("The dispatcher %s has no classic Hyprland syntax", self.Name)
+	}
+	return
+}
+
+// Render returns the commands to send over the control socket to run the
+// dispatcher with a Hyprland that has the specified capabilities
+func (self DispatchCommand) Render(caps Capabilities) ([]string, error) {
+	if caps.Lua_dispatch {
+		lua, err := self.Lua()
+		if err != nil {
+			return nil, err
+		}
+		return []string{"eval " + lua}, nil
+	}
+	return self.Legacy()
+}
+
+func dispatch(name string, args ...DispatchArg) DispatchCommand {
+	return DispatchCommand{Name: name, Args: args}
+}
+
+// with_window adds the window selector to args, omitting it for the active window
+func with_window(w WindowSelector, args ...DispatchArg) []DispatchArg {
+	if w == ActiveWindow {
+		return args
+	}
+	return append([]DispatchArg{{"window", w}}, args...)
+}
+
+// WindowSelector identifies a window, use the constructor functions to create one
+type WindowSelector string
+
+// ActiveWindow selects the currently focused window
+const ActiveWindow WindowSelector = ""
+
+func WindowAddress(addr string) WindowSelector { return WindowSelector("address:" + addr) }
+func WindowClass(regex string) WindowSelector  { return WindowSelector("class:" + regex) }
+func WindowTitle(regex string) WindowSelector  { return WindowSelector("title:" + regex) }
+func WindowPID(pid int) WindowSelector         { return WindowSelector("pid:" + strconv.Itoa(pid)) }
+
+// WorkspaceSelector identifies a workspace, use the constructor functions to create one
+type WorkspaceSelector string
+
+func WorkspaceName(name string) WorkspaceSelector    { return WorkspaceSelector("name:" + name) }
+func WorkspaceID(id int) WorkspaceSelector           { return WorkspaceSelector(strconv.Itoa(id)) }
+func SpecialWorkspace(name string) WorkspaceSelector { return WorkspaceSelector("special:" + name) }
+
+// The previously focused workspace
+const PreviousWorkspace WorkspaceSelector = "previous"
+
+type Direction string
+
+const (
+	Left  Direction = "l"
+	Right Direction = "r"
+	Up    Direction = "u"
+	Down  Direction = "d"
+)
+
+type GroupDispatchers struct{}
+
+// Toggle makes the window into a group or, if it is already grouped,
+// dissolves its group
+func (GroupDispatchers) Toggle(w WindowSelector) DispatchCommand {
+	return dispatch("group.toggle", with_window(w)...)
+}
+
+// Next focuses the next window in the group of the active window
+func (GroupDispatchers) Next() DispatchCommand { return dispatch("group.next") }
+
+// Prev focuses the previous window in the group of the active window
+func (GroupDispatchers) Prev() DispatchCommand { return dispatch("group.prev") }
+
+type Dispatchers struct {
+	Group GroupDispatchers
+}
+
+// Dispatch builds commands for Hyprland dispatchers, for example:
+//
+//	dispatch_commands(Dispatch.Focus(WindowAddress(addr)))
+var Dispatch Dispatchers
+
+func (Dispatchers) Focus(w WindowSelector) DispatchCommand {
+	return dispatch("focus", DispatchArg{"window", w})
+}
+
+func (Dispatchers) FocusWorkspace(ws WorkspaceSelector) DispatchCommand {
+	return dispatch("focus", DispatchArg{"workspace", ws})
+}
+
+// FocusWorkspaceOnCurrentMonitor shows the workspace on the focused monitor,
+// swapping workspaces if it is visible on another monitor
+func (Dispatchers) FocusWorkspaceOnCurrentMonitor(ws WorkspaceSelector) DispatchCommand {
+	return dispatch("focus", DispatchArg{"workspace", ws}, DispatchArg{"on_current_monitor", true})
+}
+
+// MoveWorkspaceToMonitor moves the workspace to the named monitor
+func (Dispatchers) MoveWorkspaceToMonitor(ws WorkspaceSelector, monitor string) DispatchCommand {
+	return dispatch("workspace.move", DispatchArg{"workspace", ws}, DispatchArg{"monitor", monitor})
+}
+
+func (Dispatchers) FocusDirection(d Direction) DispatchCommand {
+	return dispatch("focus", DispatchArg{"direction", d})
+}
+
+// MoveWindow moves the window in the specified direction. When group_aware
+// is true the window joins a group in that direction or, if it is grouped,
+// moves out of its group.
+func (Dispatchers) MoveWindow(w WindowSelector, d Direction, group_aware bool) DispatchCommand {
+	return dispatch("window.move", with_window(w, DispatchArg{"direction", d}, DispatchArg{"group_aware", group_aware})...)
+}
+
+// MoveWindowToWorkspace moves the window to the workspace, following it
+// unless silent is true
+func (Dispatchers) MoveWindowToWorkspace(w WindowSelector, ws WorkspaceSelector, silent bool) DispatchCommand {
+	return dispatch("window.move", with_window(w, DispatchArg{"workspace", ws}, DispatchArg{"silent", silent})...)
+}
+
+func (Dispatchers) MoveWindowOutOfGroup(w WindowSelector, d Direction) DispatchCommand {
+	return dispatch("window.move", with_window(w, DispatchArg{"out_of_group", d})...)
+}
+
+func (Dispatchers) CycleNext() DispatchCommand { return dispatch("window.cycle_next") }
+func (Dispatchers) CyclePrev() DispatchCommand { return dispatch("window.cycle_prev") }
+
+func (Dispatchers) Close(w WindowSelector) DispatchCommand {
+	return dispatch("window.close", with_window(w)...)
+}
+
+func (Dispatchers) ToggleFloating(w WindowSelector) DispatchCommand {
+	return dispatch("window.float", with_window(w, DispatchArg{"action", "toggle"})...)
+}
+
+func (Dispatchers) ToggleFullscreen(w WindowSelector) DispatchCommand {
+	return dispatch("window.fullscreen", with_window(w, DispatchArg{"action", "toggle"})...)
+}
+
+// ResizeWindow sets the size of the window in pixels
+func (Dispatchers) ResizeWindow(w WindowSelector, width, height int) DispatchCommand {
+	return dispatch("window.resize", with_window(w, DispatchArg{"x", width}, DispatchArg{"y", height}, DispatchArg{"relative", false})...)
+}
+
+func (Dispatchers) Pin(w WindowSelector) DispatchCommand {
+	return dispatch("window.pin", with_window(w)...)
+}
+
+// ToggleSpecialWorkspace shows or hides the named special workspace on the focused monitor
+func (Dispatchers) ToggleSpecialWorkspace(name string) DispatchCommand {
+	return dispatch("workspace.toggle_special", DispatchArg{"name", name})
+}
+
+// DPMS sets the power state of the monitor, action is one of on, off or toggle
+func (Dispatchers) DPMS(action, monitor string) DispatchCommand {
+	return dispatch("dpms", DispatchArg{"action", action}, DispatchArg{"monitor", monitor})
+}
+
+// Exec runs the command line via the shell
+func (Dispatchers) Exec(cmdline string) DispatchCommand {
+	return DispatchCommand{Name: "exec_cmd", Positional: []any{cmdline}}
+}
+
+func (Dispatchers) Exit() DispatchCommand { return dispatch("exit") }
+
+// }}}
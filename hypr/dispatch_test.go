@@ -0,0 +1,136 @@
+package hypr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestDispatchLua(t *testing.T) {
+	for _, tc := range []struct {
+		cmd      DispatchCommand
+		expected string
+	}{
+		{Dispatch.Focus(WindowAddress("0x1")), `hl.dispatch(hl.dsp.focus({ window = "address:0x1" }))`},
+		{Dispatch.FocusWorkspace(WorkspaceName("1")), `hl.dispatch(hl.dsp.focus({ workspace = "name:1" }))`},
+		{Dispatch.FocusWorkspace(WorkspaceID(3)), `hl.dispatch(hl.dsp.focus({ workspace = "3" }))`},
+		{Dispatch.FocusWorkspace(PreviousWorkspace), `hl.dispatch(hl.dsp.focus({ workspace = "previous" }))`},
+		{Dispatch.FocusWorkspaceOnCurrentMonitor(WorkspaceName("3")), `hl.dispatch(hl.dsp.focus({ workspace = "name:3", on_current_monitor = true }))`},
+		{Dispatch.MoveWorkspaceToMonitor(WorkspaceName("3"), "DP-1"), `hl.dispatch(hl.dsp.workspace.move({ workspace = "name:3", monitor = "DP-1" }))`},
+		{Dispatch.FocusDirection(Up), `hl.dispatch(hl.dsp.focus({ direction = "u" }))`},
+		{Dispatch.MoveWindow(WindowAddress("0x1"), Left, true), `hl.dispatch(hl.dsp.window.move({ window = "address:0x1", direction = "l", group_aware = true }))`},
+		{Dispatch.MoveWindowToWorkspace(ActiveWindow, WorkspaceName("web"), true), `hl.dispatch(hl.dsp.window.move({ workspace = "name:web", silent = true }))`},
+		{Dispatch.MoveWindowToWorkspace(WindowClass("^kitty$"), SpecialWorkspace("s"), false), `hl.dispatch(hl.dsp.window.move({ window = "class:^kitty$", workspace = "special:s", silent = false }))`},
+		{Dispatch.MoveWindowOutOfGroup(ActiveWindow, Left), `hl.dispatch(hl.dsp.window.move({ out_of_group = "l" }))`},
+		{Dispatch.Group.Toggle(WindowPID(12)), `hl.dispatch(hl.dsp.group.toggle({ window = "pid:12" }))`},
+		{Dispatch.Group.Next(), `hl.dispatch(hl.dsp.group.next())`},
+		{Dispatch.CycleNext(), `hl.dispatch(hl.dsp.window.cycle_next())`},
+		{Dispatch.ResizeWindow(WindowAddress("0x1"), 640, 360), `hl.dispatch(hl.dsp.window.resize({ window = "address:0x1", x = 640, y = 360, relative = false }))`},
+		{Dispatch.ToggleSpecialWorkspace("term"), `hl.dispatch(hl.dsp.workspace.toggle_special({ name = "term" }))`},
+		{Dispatch.DPMS("off", "DP-1"), `hl.dispatch(hl.dsp.dpms({ action = "off", monitor = "DP-1" }))`},
+		{Dispatch.Exec("kitty --title 'a b'"), `hl.dispatch(hl.dsp.exec_cmd("kitty --title 'a b'"))`},
+		{Dispatch.Exit(), `hl.dispatch(hl.dsp.exit())`},
+	} {
+		if actual, err := tc.cmd.Lua(); err != nil || actual != tc.expected {
+			t.Fatalf("Unexpected Lua\nexpected: %s\nactual:   %s", tc.expected, actual)
+		}
+	}
+	if actual, err := Dispatch.Exit().Render(Capabilities{Lua_dispatch: true}); err != nil || !slices.Equal(actual, []string{"eval hl.dispatch(hl.dsp.exit())"}) {
+		t.Fatalf("Unexpected command: %s", actual)
+	}
+	// unsupported argument types are reported as errors
+	bad := DispatchCommand{Name: "window.move", Args: []DispatchArg{{"direction", []string{"l"}}}}
+	if s := bad.String(); !strings.HasPrefix(s, "<invalid dispatch: ") {
+		t.Fatalf("Unexpected description of invalid dispatch: %s", s)
+	}
+	if _, err := bad.Render(Capabilities{Lua_dispatch: true}); err == nil || !strings.Contains(err.Error(), "Unsupported Lua value type: []string for direction") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestLuaQuote(t *testing.T) {
+	for raw, expected := range map[string]string{
+		``:                  `""`,
+		`simple`:            `"simple"`,
+		`a"b`:               `"a\"b"`,
+		`a\b`:               `"a\\b"`,
+		`"})) os.exit() --`: `"\"})) os.exit() --"`,
+		"tab\tnl\n":         `"tab\tnl\n"`,
+		"\x001":             `"\0001"`,
+		"\x7f":              `"\127"`,
+		"a;b":               `"a\059b"`,
+		"日本":                `"日本"`,
+	} {
+		if actual := lua_quote(raw); actual != expected {
+			t.Fatalf("Unexpected quoting of %#v\nexpected: %s\nactual:   %s", raw, expected, actual)
+		}
+		if back, err := lua_unquote(expected); err != nil || back != raw {
+			t.Fatalf("Failed to round trip %#v got: %#v err: %v", raw, back, err)
+		}
+	}
+}
+
+func TestDispatchLegacy(t *testing.T) {
+	for _, tc := range []struct {
+		cmd      DispatchCommand
+		expected []string
+	}{
+		{Dispatch.Focus(WindowAddress("0x1")), []string{"dispatch focuswindow address:0x1"}},
+		{Dispatch.FocusWorkspace(WorkspaceName("1")), []string{"dispatch workspace name:1"}},
+		{Dispatch.FocusWorkspace(PreviousWorkspace), []string{"dispatch workspace previous"}},
+		{Dispatch.FocusWorkspaceOnCurrentMonitor(WorkspaceName("3")), []string{"dispatch focusworkspaceoncurrentmonitor name:3"}},
+		{Dispatch.MoveWorkspaceToMonitor(WorkspaceName("3"), "DP-1"), []string{"dispatch moveworkspacetomonitor name:3 DP-1"}},
+		{Dispatch.MoveWindow(WindowAddress("0x1"), Left, true), []string{"dispatch focuswindow address:0x1", "dispatch movewindoworgroup l"}},
+		{Dispatch.MoveWindow(ActiveWindow, Right, false), []string{"dispatch movewindow r"}},
+		{Dispatch.MoveWindowToWorkspace(ActiveWindow, WorkspaceName("web"), true), []string{"dispatch movetoworkspacesilent name:web"}},
+		{Dispatch.MoveWindowToWorkspace(WindowAddress("0x1"), WorkspaceID(2), false), []string{"dispatch movetoworkspace 2,address:0x1"}},
+		{Dispatch.MoveWindowOutOfGroup(ActiveWindow, Left), []string{"dispatch moveoutofgroup"}},
+		{Dispatch.Group.Toggle(WindowAddress("0x1")), []string{"dispatch focuswindow address:0x1", "dispatch togglegroup"}},
+		{Dispatch.Group.Next(), []string{"dispatch changegroupactive f"}},
+		{Dispatch.CycleNext(), []string{"dispatch cyclenext"}},
+		{Dispatch.Close(ActiveWindow), []string{"dispatch killactive"}},
+		{Dispatch.ResizeWindow(WindowAddress("0x1"), 640, 360), []string{"dispatch resizewindowpixel exact 640 360,address:0x1"}},
+		{Dispatch.ToggleSpecialWorkspace("term"), []string{"dispatch togglespecialworkspace term"}},
+		{Dispatch.DPMS("off", "DP-1"), []string{"dispatch dpms off DP-1"}},
+		{Dispatch.Exec("kitty"), []string{"dispatch exec kitty"}},
+		{Dispatch.Exit(), []string{"dispatch exit"}},
+	} {
+		actual, err := tc.cmd.Legacy()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.expected, actual); diff != "" {
+			t.Fatalf("Unexpected legacy commands for %s:\n%s", tc.cmd, diff)
+		}
+	}
+	if _, err := Dispatch.FocusWorkspace(WorkspaceName("a;b")).Legacy(); err == nil {
+		t.Fatalf("No error for unrepresentable workspace name")
+	}
+}
+
+func TestCapabilities(t *testing.T) {
+	for _, tc := range []struct {
+		v      Version
+		number [3]int
+		lua    bool
+	}{
+		{Version{Version: "0.41.2", Tag: "v0.41.2-3-gabcdef"}, [3]int{0, 41, 2}, false},
+		{Version{Tag: "v0.39.1-90-gabcdef"}, [3]int{0, 39, 1}, false},
+		{Version{Version: "0.53.0"}, [3]int{0, 53, 0}, true},
+		{Version{Version: "1.0"}, [3]int{1, 0, 0}, true},
+		{Version{Tag: "unknown"}, [3]int{}, true},
+	} {
+		n, _ := tc.v.Number()
+		if n != tc.number {
+			t.Fatalf("Unexpected version number for %#v: %v", tc.v, n)
+		}
+		if c := capabilities_for(tc.v); c.Lua_dispatch != tc.lua {
+			t.Fatalf("Unexpected Lua support for %#v: %v", tc.v, c.Lua_dispatch)
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package hypr
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+var repr = utils.Repr
+var _ = repr
+
+// Hyprland event payloads use bare hex addresses while JSON replies prefix
+// them with 0x
+func normalize_address(addr string) string {
+	if addr == "" || strings.HasPrefix(addr, "0x") {
+		return addr
+	}
+	return "0x" + addr
+}
+
+// event_converter turns lines from the Hyprland events socket into
+// common.Event values. It is stateful as some events such as the active
+// window are split across multiple lines.
+type event_converter struct {
+	active_class, active_title string
+}
+
+func (self *event_converter) convert(line string) (ans []common.Event, err error) {
+	var ev Event
+	if ev, err = ParseEvent(line); err != nil {
+		return
+	}
+	a := func(ev common.Event) { ans = append(ans, ev) }
+	switch ev := ev.(type) {
+	case ActiveWindowEvent:
+		self.active_class, self.active_title = ev.Class, ev.Title
+	case ActiveWindowV2Event:
+		a(common.WindowFocused{Id: ev.Address, Class: self.active_class, Title: self.active_title})
+	case WindowTitleV2Event:
+		a(common.TitleChanged{Id: ev.Address, Title: ev.Title})
+	case WorkspaceEvent:
+		a(common.WorkspaceFocused{Name: ev.Name})
+	case FocusedMonEvent:
+		a(common.WorkspaceFocused{Name: ev.Workspace, Output: ev.Monitor})
+	case OpenWindowEvent:
+		a(common.WindowOpened{Id: ev.Address, Workspace: ev.Workspace, Class: ev.Class, Title: ev.Title})
+	case CloseWindowEvent:
+		a(common.WindowClosed{Id: ev.Address})
+	case MoveWindowV2Event:
+		a(common.WindowMoved{Id: ev.Address, Workspace: ev.Workspace})
+	case MonitorAddedEvent:
+		a(common.MonitorAdded{Name: ev.Name})
+	case MonitorRemovedEvent:
+		a(common.MonitorRemoved{Name: ev.Name})
+	case UrgentEvent:
+		a(common.Urgent{Id: ev.Address})
+	case FullscreenEvent:
+		a(common.Fullscreen{Enabled: ev.Enabled})
+	case SubmapEvent:
+		a(common.ModeChanged{Mode: ev.Name})
+	case BellEvent:
+		a(common.Bell{Id: ev.Address})
+	case ToggleGroupEvent:
+		a(common.StackChanged{})
+	case MoveIntoGroupEvent:
+		a(common.StackChanged{Id: ev.Address})
+	case MoveOutOfGroupEvent:
+		a(common.StackChanged{Id: ev.Address})
+	}
+	return
+}
+
+type events_connection struct {
+	conn      *net.UnixConn
+	send      func(common.Event)
+	converter event_converter
+}
+
+func (self *events_connection) Resync() (err error) {
+	var activeworkspace Workspace
+	var activewindow Window
+	if err = make_requests(request{"activeworkspace", &activeworkspace}, request{"activewindow", &activewindow}); err != nil {
+		return
+	}
+	self.converter = event_converter{active_class: activewindow.Class, active_title: activewindow.Title}
+	self.send(common.WorkspaceFocused{Name: activeworkspace.Name, Output: activeworkspace.Monitor})
+	self.send(common.WindowFocused{Id: activewindow.Address, Class: activewindow.Class, Title: activewindow.Title})
+	return
+}
+
+func (self *events_connection) Run() error {
+	reader := bufio.NewReader(self.conn)
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		line = strings.TrimSpace(line)
+		trace(self.conn, "events", "recv", line)
+		if evs, err := self.converter.convert(line); err != nil {
+			debugprintln("Failed to handle hyprland event:", line, "with error:", err)
+		} else {
+			for _, ev := range evs {
+				self.send(ev)
+			}
+		}
+	}
+}
+
+func (self *events_connection) Close() { self.conn.Close() }
+
+// Subscribe returns a channel of compositor events. The stream starts with
+// events describing the currently focused workspace and window. If the
+// events socket is lost, for instance when Hyprland is reloaded, it is
+// reconnected with backoff, a common.ConnectionState event is sent and the
+// state is resynced. The channel is closed when ctx is cancelled.
+func Subscribe(ctx context.Context) (events <-chan common.Event, err error) {
+	return common.SuperviseEvents(ctx, func(send func(common.Event)) (common.EventConnection, error) {
+		conn, err := GetEventsConnection()
+		if err != nil {
+			return nil, err
+		}
+		return &events_connection{conn: conn, send: send}, nil
+	})
+}
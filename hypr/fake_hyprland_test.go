@@ -0,0 +1,826 @@
+package hypr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// fake_hyprland is an in-process Hyprland instance with control and event
+// sockets in a temporary runtime dir. It serves JSON queries from a simulated
+// window state and applies the window state changes of dispatch commands.
+type fake_hyprland struct {
+	t                *testing.T
+	control, events  *net.UnixListener
+	lock             sync.Mutex
+	windows          []*Window
+	workspaces       []*Workspace
+	monitors         []Monitor
+	active_window    string
+	active_workspace int
+	// all non query commands received, in order
+	commands []string
+	// dispatches received, in order, as name(arg=val, ...)
+	dispatches   []string
+	event_conns  []*net.UnixConn
+	next_address int
+	// number of control socket connections accepted
+	connections int
+	// when true control socket requests are never answered
+	stall bool
+	// when replaying a trace, the recorded exchanges not yet replayed and
+	// the event lines to send to event listeners when they connect
+	replay        []common.IPCExchange
+	replay_events []string
+	replay_mode   bool
+	// the Hyprland release being simulated, releases before
+	// first_lua_dispatch_version only accept the classic dispatch syntax
+	version string
+	// when true windows keep the geometry they are given by the test instead
+	// of being tiled left to right, grouped windows still share geometry
+	fixed_layout bool
+	// group aware moves in these directions do nothing, simulating layouts
+	// where the window does not land in the expected group
+	ignored_directions map[string]bool
+	// dispatchers that fail
+	failing_dispatchers map[string]bool
+}
+
+func new_fake_hyprland(t *testing.T) *fake_hyprland {
+	t.Helper()
+	// keep the path short as unix socket paths are limited to 108 bytes
+	rdir, err := os.MkdirTemp("", "hypr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(rdir) })
+	const his = "testsig"
+	if err = os.MkdirAll(filepath.Join(rdir, "hypr", his), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("XDG_RUNTIME_DIR", rdir)
+	t.Setenv("XDG_STATE_HOME", t.TempDir())
+	t.Setenv(HIS, his)
+	orig := RuntimeDir
+	RuntimeDir = sync.OnceValue(runtime_dir)
+	orig_delay := dpms_delay
+	dpms_delay = 0
+	t.Cleanup(func() { RuntimeDir = orig; dpms_delay = orig_delay })
+	listen := func(name string) *net.UnixListener {
+		l, err := net.ListenUnix("unix", &net.UnixAddr{Name: filepath.Join(RuntimeDir(), name), Net: "unix"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return l
+	}
+	self := &fake_hyprland{t: t, control: listen(".socket.sock"), events: listen(".socket2.sock"), next_address: 0x1000, version: "0.53.0"}
+	self.monitors = []Monitor{{Id: 0, Name: "eDP-1", Focused: true, Width: 1920, Height: 1080}, {Id: 1, Name: "HDMI-A-1", Width: 1920, Height: 1080}}
+	self.workspaces = []*Workspace{{Id: 1, Name: "1", Monitor: "eDP-1"}}
+	self.active_workspace = 1
+	t.Cleanup(self.close)
+	go self.serve_control()
+	go self.serve_events()
+	return self
+}
+
+func (self *fake_hyprland) close() {
+	self.control.Close()
+	self.events.Close()
+	self.disconnect_events()
+}
+
+// disconnect_events closes all event socket connections, simulating a
+// compositor reload
+func (self *fake_hyprland) disconnect_events() {
+	self.lock.Lock()
+	conns := self.event_conns
+	self.event_conns = nil
+	self.lock.Unlock()
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+func (self *fake_hyprland) serve_events() {
+	for {
+		conn, err := self.events.AcceptUnix()
+		if err != nil {
+			return
+		}
+		self.lock.Lock()
+		self.event_conns = append(self.event_conns, conn)
+		events := self.replay_events
+		self.replay_events = nil
+		for _, line := range events {
+			conn.Write([]byte(line + "\n"))
+		}
+		self.lock.Unlock()
+	}
+}
+
+func (self *fake_hyprland) num_event_conns() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.event_conns)
+}
+
+// emit sends an event line to all connected event listeners
+func (self *fake_hyprland) emit(lines ...string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.emit_locked(lines...)
+}
+
+func (self *fake_hyprland) emit_locked(lines ...string) {
+	for _, c := range self.event_conns {
+		for _, line := range lines {
+			c.Write([]byte(line + "\n"))
+		}
+	}
+}
+
+func (self *fake_hyprland) serve_control() {
+	for {
+		conn, err := self.control.AcceptUnix()
+		if err != nil {
+			return
+		}
+		self.lock.Lock()
+		self.connections++
+		stall := self.stall
+		self.lock.Unlock()
+		go func() {
+			defer conn.Close()
+			buf := make([]byte, 64*1024)
+			n, err := conn.Read(buf)
+			if err != nil {
+				return
+			}
+			if stall {
+				// wait for the client to give up
+				conn.Read(buf)
+				return
+			}
+			conn.Write([]byte(self.respond(string(buf[:n]))))
+		}()
+	}
+}
+
+func (self *fake_hyprland) respond(req string) string {
+	self.lock.Lock()
+	if !self.replay_mode {
+		self.lock.Unlock()
+		return self.handle_request(req)
+	}
+	defer self.lock.Unlock()
+	if len(self.replay) == 0 {
+		self.t.Errorf("Fake Hyprland got request: %s after the end of the trace", req)
+		return ""
+	}
+	x := self.replay[0]
+	self.replay = self.replay[1:]
+	if x.Request.Payload != req {
+		self.t.Errorf("Request differs from trace\nexpected: %s\nactual:   %s", x.Request.Payload, req)
+	}
+	if x.Response == nil {
+		return ""
+	}
+	return x.Response.Payload
+}
+
+// new_replay_hyprland returns a fake Hyprland that answers control socket
+// requests with the responses recorded in the trace file, in order, failing
+// the test if the requests differ from the recorded ones. Recorded events are
+// sent to the first connection to the events socket.
+func new_replay_hyprland(t *testing.T, trace_path string) *fake_hyprland {
+	t.Helper()
+	records, err := common.ReadIPCTrace(trace_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = utils.Filter(records, func(r common.IPCTraceRecord) bool { return r.Backend == "hyprland" })
+	self := new_fake_hyprland(t)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.replay_mode = true
+	exchanges, unsolicited := common.PairIPCTrace(records)
+	for _, x := range exchanges {
+		if x.Request.Socket == "control" {
+			self.replay = append(self.replay, x)
+		}
+	}
+	for _, r := range unsolicited {
+		if r.Socket == "events" {
+			self.replay_events = append(self.replay_events, r.Payload)
+		}
+	}
+	return self
+}
+
+// unreplayed returns the number of recorded exchanges not yet replayed
+func (self *fake_hyprland) unreplayed() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.replay)
+}
+
+func (self *fake_hyprland) handle_request(req string) string {
+	var cmds []string
+	if rest, found := strings.CutPrefix(req, "[[BATCH]]"); found {
+		cmds = strings.Split(strings.TrimSuffix(rest, ";"), ";")
+	} else {
+		cmds = []string{req}
+	}
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	responses := make([]string, len(cmds))
+	for i, cmd := range cmds {
+		responses[i] = self.handle_command(cmd)
+	}
+	return strings.Join(responses, "\n\n\n")
+}
+
+func as_json(x any) string {
+	ans, _ := json.Marshal(x)
+	return string(ans)
+}
+
+func (self *fake_hyprland) handle_command(cmd string) string {
+	cmd = strings.TrimPrefix(cmd, "j/")
+	switch cmd {
+	case "clients":
+		ans := make([]Window, len(self.windows))
+		for i, w := range self.windows {
+			ans[i] = *w
+		}
+		return as_json(ans)
+	case "activewindow":
+		if w := self.window(self.active_window); w != nil {
+			return as_json(w)
+		}
+		return "{}"
+	case "workspaces":
+		return as_json(self.workspace_list())
+	case "activeworkspace":
+		for _, ws := range self.workspace_list() {
+			if ws.Id == self.active_workspace {
+				return as_json(ws)
+			}
+		}
+		return "{}"
+	case "monitors", "monitors all":
+		ans := slices.Clone(self.monitors)
+		for i, m := range ans {
+			if m.Focused {
+				for _, ws := range self.workspaces {
+					if ws.Id == self.active_workspace {
+						ans[i].Active_workspace.Id, ans[i].Active_workspace.Name = ws.Id, ws.Name
+					}
+				}
+			}
+		}
+		return as_json(ans)
+	case "version":
+		return as_json(Version{Branch: "main", Version: self.version, Tag: "v" + self.version})
+	}
+	self.commands = append(self.commands, cmd)
+	if rest, found := strings.CutPrefix(cmd, "eval "); found {
+		if n, _ := (Version{Version: self.version}).Number(); slices.Compare(n[:], first_lua_dispatch_version[:]) < 0 {
+			return "unknown request"
+		}
+		name, args, err := parse_dispatch(rest)
+		if err != nil {
+			return err.Error()
+		}
+		return self.dispatch(name, args)
+	}
+	if rest, found := strings.CutPrefix(cmd, "dispatch "); found {
+		name, args, err := parse_legacy_dispatch(rest)
+		if err != nil {
+			return err.Error()
+		}
+		return self.dispatch(name, args)
+	}
+	return "unknown request"
+}
+
+// parse_legacy_dispatch converts the classic dispatcher syntax into the
+// equivalent Lua dispatcher and arguments
+func parse_legacy_dispatch(cmd string) (name string, args map[string]string, err error) {
+	dispatcher, arg, _ := strings.Cut(cmd, " ")
+	args = map[string]string{}
+	switch dispatcher {
+	case "focuswindow":
+		name, args["window"] = "focus", arg
+	case "workspace":
+		name, args["workspace"] = "focus", arg
+	case "movetoworkspace", "movetoworkspacesilent":
+		name = "window.move"
+		ws, window, _ := strings.Cut(arg, ",")
+		args["workspace"], args["silent"] = ws, strconv.FormatBool(dispatcher == "movetoworkspacesilent")
+		if window != "" {
+			args["window"] = window
+		}
+	case "movewindow", "movewindoworgroup":
+		name, args["direction"], args["group_aware"] = "window.move", arg, strconv.FormatBool(dispatcher == "movewindoworgroup")
+	case "moveoutofgroup":
+		name, args["out_of_group"] = "window.move", "l"
+		if arg != "" {
+			args["window"] = arg
+		}
+	case "togglegroup":
+		name = "group.toggle"
+	case "changegroupactive":
+		name = utils.IfElse(arg == "b", "group.prev", "group.next")
+	case "togglefloating":
+		name = "window.float"
+		if arg != "" {
+			args["window"] = arg
+		}
+	case "resizewindowpixel":
+		name = "window.resize"
+		size, window, _ := strings.Cut(strings.TrimPrefix(arg, "exact "), ",")
+		args["x"], args["y"], _ = strings.Cut(size, " ")
+		if window != "" {
+			args["window"] = window
+		}
+	case "fullscreen":
+		name = "window.fullscreen"
+	case "cyclenext":
+		name = "window.cycle_next"
+	case "dpms":
+		name = "dpms"
+		args["action"], args["monitor"], _ = strings.Cut(arg, " ")
+	case "togglespecialworkspace":
+		name, args["name"] = "workspace.toggle_special", arg
+	case "exit":
+		name = "exit"
+	default:
+		err = fmt.Errorf("Invalid dispatcher")
+	}
+	return
+}
+
+func (self *fake_hyprland) workspace_list() (ans []Workspace) {
+	for _, ws := range self.workspaces {
+		w := *ws
+		for _, win := range self.windows {
+			if win.Workspace.Id == ws.Id {
+				w.Windows++
+			}
+		}
+		ans = append(ans, w)
+	}
+	return
+}
+
+var dispatch_pat = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`^hl\.dispatch\(hl\.dsp\.([\w.]+)\((.*)\)\)$`)
+})
+var lua_table_entry_pat = sync.OnceValue(func() *regexp.Regexp {
+	return regexp.MustCompile(`(\w+)\s*=\s*("(?:[^"\\]|\\.)*"|[\w.-]+)`)
+})
+
+// parse_dispatch parses hl.dispatch(hl.dsp.NAME({ key = value, ... }))
+func parse_dispatch(expr string) (name string, args map[string]string, err error) {
+	m := dispatch_pat().FindStringSubmatch(expr)
+	if m == nil {
+		return "", nil, fmt.Errorf("not a dispatch expression: %s", expr)
+	}
+	name, args = m[1], map[string]string{}
+	for _, e := range lua_table_entry_pat().FindAllStringSubmatch(m[2], -1) {
+		val := e[2]
+		if strings.HasPrefix(val, `"`) {
+			if val, err = lua_unquote(val); err != nil {
+				return
+			}
+		}
+		args[e[1]] = val
+	}
+	return
+}
+
+// lua_unquote decodes the subset of Lua string literal syntax produced by lua_quote
+func lua_unquote(q string) (string, error) {
+	q = q[1 : len(q)-1]
+	b := strings.Builder{}
+	for i := 0; i < len(q); i++ {
+		if q[i] != '\\' {
+			b.WriteByte(q[i])
+			continue
+		}
+		if i++; i >= len(q) {
+			return "", fmt.Errorf("Trailing backslash in Lua string")
+		}
+		switch c := q[i]; c {
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 't':
+			b.WriteByte('\t')
+		case '"', '\\', '\'':
+			b.WriteByte(c)
+		default:
+			if i+3 > len(q) {
+				return "", fmt.Errorf("Invalid escape in Lua string: %s", q[i:])
+			}
+			n, err := strconv.Atoi(q[i : i+3])
+			if err != nil || n > 255 {
+				return "", fmt.Errorf("Invalid escape in Lua string: %s", q[i:i+3])
+			}
+			b.WriteByte(byte(n))
+			i += 2
+		}
+	}
+	return b.String(), nil
+}
+
+func (self *fake_hyprland) window(addr string) *Window {
+	for _, w := range self.windows {
+		if w.Address == addr {
+			return w
+		}
+	}
+	return nil
+}
+
+func (self *fake_hyprland) workspace_by_name(name string, create bool) *Workspace {
+	for _, ws := range self.workspaces {
+		if ws.Name == name {
+			return ws
+		}
+	}
+	if !create {
+		return nil
+	}
+	// like Hyprland special workspaces have negative ids
+	special := strings.HasPrefix(name, "special:")
+	id := 0
+	for _, ws := range self.workspaces {
+		id = utils.IfElse(special, min(id, ws.Id), max(id, ws.Id))
+	}
+	ws := &Workspace{Id: utils.IfElse(special, id-1, id+1), Name: name, Monitor: "eDP-1"}
+	self.workspaces = append(self.workspaces, ws)
+	return ws
+}
+
+// add_window adds a tiled window to the named workspace, creating it if needed
+func (self *fake_hyprland) add_window(class, title, workspace string) *Window {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	ws := self.workspace_by_name(workspace, true)
+	self.next_address++
+	w := &Window{Address: fmt.Sprintf("0x%x", self.next_address), Class: class, Title: title, Pid: self.next_address, Mapped: true}
+	w.Workspace.Id, w.Workspace.Name = ws.Id, ws.Name
+	self.windows = append(self.windows, w)
+	self.relayout(ws.Id)
+	return w
+}
+
+// relayout tiles the windows on the workspace left to right, grouped windows
+// share the geometry of their group
+func (self *fake_hyprland) relayout(ws_id int) {
+	if self.fixed_layout {
+		for _, w := range self.windows {
+			if w.Workspace.Id == ws_id && len(w.Grouped) > 0 {
+				if g := self.window(w.Grouped[0]); g != nil {
+					w.At, w.Size = g.At, g.Size
+				}
+			}
+		}
+		return
+	}
+	x := 0
+	placed := map[string][2]int{}
+	for _, w := range self.windows {
+		if w.Workspace.Id != ws_id || w.Floating {
+			continue
+		}
+		if len(w.Grouped) > 0 {
+			if at, found := placed[w.Grouped[0]]; found {
+				w.At, w.Size = at, [2]int{100, 100}
+				continue
+			}
+		}
+		w.At, w.Size = [2]int{x, 0}, [2]int{100, 100}
+		if len(w.Grouped) > 0 {
+			placed[w.Grouped[0]] = w.At
+		}
+		x += 100
+	}
+}
+
+func (self *fake_hyprland) set_active_window(addr string) {
+	self.active_window = addr
+	w := self.window(addr)
+	if w == nil {
+		self.emit_locked("activewindow>>,", "activewindowv2>>")
+		return
+	}
+	for _, x := range self.windows {
+		if x != w {
+			x.Focus_history_id++
+		}
+	}
+	w.Focus_history_id = 0
+	self.emit_locked("activewindow>>"+w.Class+","+w.Title, "activewindowv2>>"+strings.TrimPrefix(w.Address, "0x"))
+	if self.active_workspace != w.Workspace.Id && w.Workspace.Id > 0 {
+		self.active_workspace = w.Workspace.Id
+		self.emit_locked("workspace>>" + w.Workspace.Name)
+	}
+}
+
+func (self *fake_hyprland) set_group(addrs []string) {
+	for _, a := range addrs {
+		if w := self.window(a); w != nil {
+			w.Grouped = slices.Clone(addrs)
+		}
+	}
+}
+
+func (self *fake_hyprland) remove_from_group(w *Window) {
+	rest := slices.DeleteFunc(slices.Clone(w.Grouped), func(a string) bool { return a == w.Address })
+	w.Grouped = nil
+	self.set_group(rest)
+	self.move_to_end(w)
+}
+
+// remove_from_group_towards removes the window from its group, placing it
+// next to the group in the specified direction
+func (self *fake_hyprland) remove_from_group_towards(w *Window, direction string) {
+	group := w.Grouped
+	self.remove_from_group(w)
+	self.windows = self.windows[:len(self.windows)-1]
+	pos := -1
+	for i, x := range self.windows {
+		if slices.Contains(group, x.Address) {
+			if direction == "l" || direction == "u" {
+				pos = i
+				break
+			}
+			pos = i + 1
+		}
+	}
+	self.windows = slices.Insert(self.windows, max(pos, 0), w)
+}
+
+// move_to_end places the window at the end of the layout, as happens for
+// windows moved out of groups or into other workspaces
+func (self *fake_hyprland) move_to_end(w *Window) {
+	idx := slices.Index(self.windows, w)
+	self.windows = append(slices.Delete(self.windows, idx, idx+1), w)
+}
+
+// neighbour returns the closest tiled window in the specified direction that
+// is not in the same group as w
+func (self *fake_hyprland) neighbour(w *Window, direction string) (ans *Window) {
+	dist := -1
+	for _, x := range self.windows {
+		if x == w || x.Workspace.Id != w.Workspace.Id || x.Floating || slices.Contains(w.Grouped, x.Address) {
+			continue
+		}
+		var d int
+		switch direction {
+		case "l":
+			d = w.At[0] - x.At[0]
+		case "r":
+			d = x.At[0] - w.At[0]
+		case "u":
+			d = w.At[1] - x.At[1]
+		case "d":
+			d = x.At[1] - w.At[1]
+		}
+		if d > 0 && (dist < 0 || d < dist) {
+			dist, ans = d, x
+		}
+	}
+	return
+}
+
+func (self *fake_hyprland) dispatch(name string, args map[string]string) string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	desc := make([]string, len(keys))
+	for i, k := range keys {
+		desc[i] = k + "=" + args[k]
+	}
+	self.dispatches = append(self.dispatches, name+"("+strings.Join(desc, ", ")+")")
+	if self.failing_dispatchers[name] {
+		return "dispatcher failed"
+	}
+	target := func() *Window {
+		if a, found := strings.CutPrefix(args["window"], "address:"); found {
+			return self.window(a)
+		}
+		return self.window(self.active_window)
+	}
+	switch name {
+	case "focus":
+		if ws_name, found := strings.CutPrefix(args["workspace"], "name:"); found {
+			ws := self.workspace_by_name(ws_name, true)
+			self.active_workspace = ws.Id
+			self.emit_locked("workspace>>" + ws.Name)
+			var last *Window
+			for _, w := range self.windows {
+				if w.Workspace.Id == ws.Id && (last == nil || w.Focus_history_id < last.Focus_history_id) {
+					last = w
+				}
+			}
+			self.set_active_window(address_of(last))
+		} else if w := target(); w != nil {
+			self.set_active_window(w.Address)
+		} else {
+			return "window not found"
+		}
+	case "window.move":
+		w := target()
+		if w == nil {
+			return "no window"
+		}
+		switch {
+		case args["workspace"] != "":
+			ws := self.workspace_by_name(strings.TrimPrefix(args["workspace"], "name:"), true)
+			old := w.Workspace.Id
+			if len(w.Grouped) > 0 {
+				self.remove_from_group(w)
+			}
+			w.Workspace.Id, w.Workspace.Name = ws.Id, ws.Name
+			self.move_to_end(w)
+			self.relayout(old)
+			self.relayout(ws.Id)
+			if args["silent"] == "true" && w.Address == self.active_window {
+				self.active_window = ""
+				for _, x := range self.windows {
+					if x.Workspace.Id == old {
+						self.active_window = x.Address
+						break
+					}
+				}
+			}
+		case args["out_of_group"] != "":
+			if len(w.Grouped) > 0 {
+				self.remove_from_group(w)
+				self.relayout(w.Workspace.Id)
+			}
+		case args["direction"] != "":
+			if args["group_aware"] == "true" && self.ignored_directions[args["direction"]] {
+				break
+			}
+			if args["group_aware"] == "true" && len(w.Grouped) > 1 {
+				self.remove_from_group_towards(w, args["direction"])
+			} else if n := self.neighbour(w, args["direction"]); n != nil {
+				if args["group_aware"] == "true" && len(n.Grouped) > 0 {
+					self.set_group(append(slices.Clone(n.Grouped), w.Address))
+				} else {
+					// swap positions in the layout
+					i, j := slices.Index(self.windows, w), slices.Index(self.windows, n)
+					self.windows[i], self.windows[j] = n, w
+				}
+			}
+			self.relayout(w.Workspace.Id)
+		}
+	case "group.toggle":
+		w := target()
+		if w == nil {
+			return "no window"
+		}
+		if len(w.Grouped) > 0 {
+			for _, a := range w.Grouped {
+				if x := self.window(a); x != nil {
+					x.Grouped = nil
+				}
+			}
+		} else {
+			w.Grouped = []string{w.Address}
+		}
+		self.relayout(w.Workspace.Id)
+	case "window.float":
+		w := target()
+		if w == nil {
+			return "no window"
+		}
+		w.Floating = !w.Floating
+		self.relayout(w.Workspace.Id)
+	case "window.resize":
+		w := target()
+		if w == nil {
+			return "no window"
+		}
+		w.Size[0], _ = strconv.Atoi(args["x"])
+		w.Size[1], _ = strconv.Atoi(args["y"])
+	case "window.fullscreen":
+		w := target()
+		if w == nil {
+			return "no window"
+		}
+		w.Fullscreen = utils.IfElse(w.Fullscreen == 0, 2, 0)
+	case "group.next":
+		if w := self.window(self.active_window); w != nil && len(w.Grouped) > 1 {
+			idx := slices.Index(w.Grouped, w.Address)
+			self.set_active_window(w.Grouped[(idx+1)%len(w.Grouped)])
+		}
+	case "window.cycle_next":
+		if w := self.window(self.active_window); w != nil {
+			same := slices.DeleteFunc(slices.Clone(self.windows), func(x *Window) bool { return x.Workspace.Id != w.Workspace.Id })
+			idx := slices.Index(same, w)
+			self.set_active_window(same[(idx+1)%len(same)].Address)
+		}
+	case "workspace.toggle_special":
+		for i, m := range self.monitors {
+			if !m.Focused {
+				continue
+			}
+			sw := &self.monitors[i].Special_workspace
+			if sw.Name == "special:"+args["name"] {
+				sw.Id, sw.Name = 0, ""
+			} else {
+				ws := self.workspace_by_name("special:"+args["name"], true)
+				sw.Id, sw.Name = ws.Id, ws.Name
+			}
+		}
+	case "dpms":
+		for i, m := range self.monitors {
+			if m.Name == args["monitor"] {
+				self.monitors[i].DPMS_status = args["action"] == "on" || (args["action"] == "toggle" && !m.DPMS_status)
+			}
+		}
+	case "exit":
+	default:
+		return "unknown dispatcher: " + name
+	}
+	self.workspaces = slices.DeleteFunc(self.workspaces, func(ws *Workspace) bool {
+		return ws.Id != self.active_workspace && !self.special_workspace_shown(ws.Id) && !slices.ContainsFunc(self.windows, func(w *Window) bool { return w.Workspace.Id == ws.Id })
+	})
+	return "ok"
+}
+
+func (self *fake_hyprland) special_workspace_shown(id int) bool {
+	return slices.ContainsFunc(self.monitors, func(m Monitor) bool { return m.Special_workspace.Id == id })
+}
+
+func (self *fake_hyprland) shown_special_workspace() string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, m := range self.monitors {
+		if m.Focused {
+			return m.Special_workspace.Name
+		}
+	}
+	return ""
+}
+
+func address_of(w *Window) string {
+	if w == nil {
+		return ""
+	}
+	return w.Address
+}
+
+func (self *fake_hyprland) received_dispatches() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return slices.Clone(self.dispatches)
+}
+
+func (self *fake_hyprland) snapshot() (windows []Window, active string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, w := range self.windows {
+		windows = append(windows, *w)
+	}
+	return windows, self.active_window
+}
+
+func (self *fake_hyprland) focus(addr string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.set_active_window(addr)
+}
+
+func (self *fake_hyprland) active_workspace_name() string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, ws := range self.workspaces {
+		if ws.Id == self.active_workspace {
+			return ws.Name
+		}
+	}
+	return ""
+}
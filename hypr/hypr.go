@@ -1,15 +1,12 @@
 package hypr
 
 import (
-	"bytes"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"path/filepath"
 	"slices"
-	"strings"
 	"sync"
 	"time"
 	"wm/common"
@@ -25,21 +22,19 @@ var debugprintln = tty.DebugPrintln
 
 const HIS = "HYPRLAND_INSTANCE_SIGNATURE"
 
-var RuntimeDir = sync.OnceValue(func() string {
+func runtime_dir() string {
 	his := os.Getenv(HIS)
 	if his == "" {
 		return ""
 	}
-	rdir := os.Getenv("XDG_RUNTIME_DIR")
-	if rdir == "" {
-		rdir = fmt.Sprintf("/run/user/%d", os.Geteuid())
-	}
-	rdir = filepath.Join(rdir, "hypr", his)
+	rdir := filepath.Join(common.RuntimeDir(), "hypr", his)
 	if unix.Access(rdir, unix.X_OK|unix.R_OK) != nil {
 		rdir = ""
 	}
 	return rdir
-})
+}
+
+var RuntimeDir = sync.OnceValue(runtime_dir)
 
 func get_conn(which string) (conn *net.UnixConn, err error) {
 	rdir := RuntimeDir()
@@ -164,80 +159,18 @@ type request struct {
 	response any
 }
 
-func send_commands(commands ...string) (responses []string, err error) {
-	var conn *net.UnixConn
-	if conn, err = GetControlConnection(); err != nil {
-		return
-	}
-	defer conn.Close()
-	q := strings.Builder{}
-	q.WriteString("[[BATCH]]")
-	for _, r := range commands {
-		q.WriteString("j/")
-		q.WriteString(r)
-		q.WriteString(";")
-	}
-	if _, err = conn.Write(utils.UnsafeStringToBytes(q.String())); err != nil {
-		return
-	}
-	var data []byte
-	if data, err = io.ReadAll(conn); err != nil {
-		return
-	}
-	for _, c := range commands {
-		pos := bytes.Index(data, []byte{'\n', '\n', '\n'})
-		chunk := utils.IfElse(pos < 0, data, data[:pos+3])
-		q := strings.TrimSpace(string(chunk))
-		responses = append(responses, q)
-		if q != "ok" {
-			err = fmt.Errorf("The command: %s returned an error response: %s", c, q)
-		}
-		data = data[len(chunk):]
-	}
-	return
-
-}
-
 func make_requests(requests ...request) (err error) {
-	var conn *net.UnixConn
-	if conn, err = GetControlConnection(); err != nil {
-		return
-	}
-	defer conn.Close()
-	q := strings.Builder{}
-	q.WriteString("[[BATCH]]")
-	for _, r := range requests {
-		q.WriteString("j/")
-		q.WriteString(r.cmd)
-		q.WriteString(";")
-	}
-	if _, err = conn.Write(utils.UnsafeStringToBytes(q.String())); err != nil {
-		return
-	}
-	var data []byte
-	if data, err = io.ReadAll(conn); err != nil {
-		return
-	}
+	b := Batch{}
 	for _, r := range requests {
-		pos := bytes.Index(data, []byte{'\n', '\n', '\n'})
-		chunk := utils.IfElse(pos < 0, data, data[:pos+3])
-		if err = json.Unmarshal(chunk, r.response); err != nil {
-			return
-		}
-		data = data[len(chunk):]
+		b.Query(r.cmd, r.response)
 	}
-	return
+	return run_batch(&b)
 }
 
-func (self Window) Direction_to(dest Window) string {
-	switch {
-	case self.At[0] == dest.At[0]:
-		return utils.IfElse(self.At[1] < dest.At[1], "d", "u")
-	case self.At[0] < dest.At[0]:
-		return "r"
-	default:
-		return "l"
-	}
+// dispatch_commands runs the dispatchers using the syntax supported by the
+// running Hyprland instance
+func dispatch_commands(cmds ...DispatchCommand) (err error) {
+	return run_batch(new(Batch).Dispatch(cmds...))
 }
 
 func GetWindowRegions() (regions []common.WindowRegion, err error) {
@@ -274,24 +207,24 @@ func GetPIDsForGracefulShutdown() []int {
 }
 
 func ExitHyprland() (err error) {
-	_, err = send_commands("eval hl.dispatch(hl.dsp.exit())")
+	err = dispatch_commands(Dispatch.Exit())
 	return err
 }
 
-func focus_window(addr string) string {
-	return fmt.Sprintf(`eval hl.dispatch(hl.dsp.focus({ window = "address:%s" }))`, addr)
+func focus_window(addr string) DispatchCommand {
+	return Dispatch.Focus(WindowAddress(addr))
 }
 
-func move_active_window_out_of_group() string {
-	return `eval hl.dispatch(hl.dsp.window.move({ out_of_group = "l" }))`
+func move_active_window_out_of_group() DispatchCommand {
+	return Dispatch.MoveWindowOutOfGroup(ActiveWindow, Left)
 }
 
-func move_window_in_direction(addr, direction string, group_aware bool) string {
-	return fmt.Sprintf(`eval hl.dispatch(hl.dsp.window.move({ window = "address:%s", direction = "%s", group_aware = %v }))`, addr, direction, group_aware)
+func move_window_in_direction(addr, direction string, group_aware bool) DispatchCommand {
+	return Dispatch.MoveWindow(WindowAddress(addr), Direction(direction), group_aware)
 }
 
-func make_window_into_group(addr string) string {
-	return fmt.Sprintf(`eval hl.dispatch(hl.dsp.group.toggle({ window = "address:%s" }))`, addr)
+func make_window_into_group(addr string) DispatchCommand {
+	return Dispatch.Group.Toggle(WindowAddress(addr))
 }
 
 func window_is_grouped(w Window) bool {
@@ -318,12 +251,28 @@ func toggle_stack() (err error) {
 	}
 	is_grouped := slices.ContainsFunc(clients, window_is_grouped)
 	if is_grouped {
-		for _, c := range clients {
-			send_commands(focus_window(c.Address), move_active_window_out_of_group())
+		restored, rerr := restore_saved_layout(workspace.Name, clients, active_window)
+		if rerr != nil {
+			// the workspace may be partially restored, un-group whatever
+			// remains grouped instead
+			debugprintln("Failed to restore the layout of the workspace:", workspace.Name, "with error:", rerr)
+			restored = false
 		}
-		// Make active window the master
-		_, err = send_commands(focus_window(active_window.Address), move_window_in_direction(active_window.Address, "l", false))
-		return
+		if !restored {
+			b := Batch{}
+			for _, c := range clients {
+				b.Dispatch(focus_window(c.Address), move_active_window_out_of_group())
+			}
+			// Make active window the master
+			b.Dispatch(focus_window(active_window.Address), move_window_in_direction(active_window.Address, "l", false))
+			if err = run_batch(&b); err != nil {
+				return
+			}
+		}
+		if err = save_layout(workspace.Name, nil); err != nil {
+			return
+		}
+		return set_workspace_stacked(workspace.Name, false)
 	}
 
 	if len(clients) > 0 { // group all windows
@@ -334,132 +283,157 @@ func toggle_stack() (err error) {
 				break
 			}
 		}
+		if err = save_layout(workspace.Name, clients); err != nil {
+			return
+		}
+		// Query the window positions in the same request as the commands
+		// that change them, to minimise round trips
+		var nclients []Window
+		b := Batch{}
 		if len(q.Grouped) == 0 {
-			if _, err = send_commands(focus_window(q.Address), make_window_into_group(q.Address)); err != nil {
-				return
-			}
+			b.Dispatch(focus_window(q.Address), make_window_into_group(q.Address))
+		}
+		if err = run_batch(b.Query("clients", &nclients)); err != nil {
+			return
 		}
-		addresses_to_move := utils.NewSet[string](len(clients))
+		addresses := make([]string, 0, len(clients))
 		for _, c := range clients {
 			if c.Address != q.Address {
-				addresses_to_move.Add(c.Address)
+				addresses = append(addresses, c.Address)
 			}
 		}
-		for addresses_to_move.Len() > 0 {
-			addr := addresses_to_move.Any()
-			addresses_to_move.Discard(addr)
-			var nclients []Window
-			if err = make_requests(request{"clients", &nclients}); err != nil {
-				return
-			}
-			nclients = utils.Filter(nclients, window_is_moveable)
-			var dest Window
-			found := false
-			for _, x := range nclients {
-				if x.Address == q.Address {
-					found = true
-					dest = x
-					break
-				}
-			}
-			if found {
-				for _, x := range nclients {
-					if x.Address == q.Address {
-						continue
-					}
-					direction := x.Direction_to(dest)
-					if _, err = send_commands(
-						move_window_in_direction(x.Address, direction, true),
-					); err != nil {
-						return
-					}
-					break
-				}
-			}
+		if err = stack_windows(q.Address, addresses, nclients); err != nil {
+			return
 		}
-		if _, err = send_commands(focus_window(active_window.Address)); err != nil {
+		if err = dispatch_commands(focus_window(active_window.Address)); err != nil {
 			return
 		}
+		return set_workspace_stacked(workspace.Name, true)
 	}
 	return
 }
 
-func ToggleStackMain(args []string) (rc int, err error) {
+func ToggleStack() (err error) {
 	// Simplify if https://github.com/hyprwm/Hyprland/discussions/10464 is implemented
-	err = toggle_stack()
-	return utils.IfElse(err == nil, 0, 1), err
+	return toggle_stack()
 }
 
+var dpms_delay = time.Second
+
 func TogglePower(action, output_name_glob string) (err error) {
 	var monitors []Monitor
 	if err = make_requests(request{"monitors all", &monitors}); err != nil {
 		return
 	}
-	commands := []string{}
+	commands := []DispatchCommand{}
 	for _, m := range monitors {
 		if match, err := filepath.Match(output_name_glob, m.Name); err != nil {
 			return err
 		} else if match {
-			commands = append(commands, fmt.Sprintf(`eval hl.dispatch(hl.dsp.dpms({ action = "%s", monitor = "%s" }))`, action, m.Name))
+			commands = append(commands, Dispatch.DPMS(action, m.Name))
 		}
 	}
 	if len(commands) > 0 {
 		// issue the actual dpms command after a second so that any key release events dont re-awaken the monitors
 		// this should really be fixed in hyprland by having it not wakeup on release events.
-		time.Sleep(time.Second)
-		_, err = send_commands(commands...)
+		time.Sleep(dpms_delay)
+		err = dispatch_commands(commands...)
 	}
 	return
 }
 
 func ChangeToWorkspace(name string) (err error) {
-	_, err = send_commands(switch_to_worksapce(name))
+	if name == common.WorkspaceBackAndForth {
+		return dispatch_commands(Dispatch.FocusWorkspace(PreviousWorkspace))
+	}
+	err = dispatch_commands(switch_to_worksapce(name))
 	return
 }
 
-func movetoworkspacesilent(name string) string {
-	return fmt.Sprintf(`eval hl.dispatch(hl.dsp.window.move({ workspace = "name:%s", silent = true }))`, name)
+func BringWorkspaceHere(name string) error {
+	return dispatch_commands(Dispatch.FocusWorkspaceOnCurrentMonitor(WorkspaceName(name)))
 }
 
-func switch_to_worksapce(name string) string {
-	return fmt.Sprintf(`eval hl.dispatch(hl.dsp.focus({ workspace = "name:%s" }))`, name)
+func MoveWorkspaceToOutput(workspace, output string) error {
+	return dispatch_commands(Dispatch.MoveWorkspaceToMonitor(WorkspaceName(workspace), output))
 }
 
-// move the window managing the window stacks in source and description workspaces
-func move_to_workspace(active_workspace Workspace, active_window Window, target_workspace Workspace, windows []Window) (err error) {
-	if active_workspace.Id == target_workspace.Id {
-		return
+func movetoworkspacesilent(addr, name string) DispatchCommand {
+	return Dispatch.MoveWindowToWorkspace(WindowAddress(addr), WorkspaceName(name), true)
+}
+
+func switch_to_worksapce(name string) DispatchCommand {
+	return Dispatch.FocusWorkspace(WorkspaceName(name))
+}
+
+// join_stack returns the commands to make the window join the stack in the
+// workspace, or become a stack if it is the only window in the workspace,
+// switching to the workspace return_to afterwards
+func join_stack(window Window, ws Workspace, windows []Window, return_to string) (cmds []DispatchCommand) {
+	if len(window.Grouped) > 0 {
+		return nil
 	}
-	cmds := []string{}
-	active_window_was_grouped := len(active_window.Grouped) > 0
-	target_workspace_is_stacked := false
+	is_stacked, others := false, 0
 	for _, w := range windows {
-		if w.Workspace.Id == target_workspace.Id && len(w.Grouped) > 0 {
-			target_workspace_is_stacked = true
-			break
+		if w.Workspace.Id == ws.Id && w.Address != window.Address {
+			others++
+			if len(w.Grouped) > 0 {
+				is_stacked = true
+			}
 		}
 	}
-	if active_window_was_grouped {
-		cmds = append(cmds, make_window_into_group(active_window.Address))
-	}
-	cmds = append(cmds, movetoworkspacesilent(target_workspace.Name))
-	if target_workspace_is_stacked {
+	switch {
+	case is_stacked:
+		// windows arriving from other workspaces are placed last, so the stack is to their left
+		direction := "l"
+		if window.Workspace.Id == ws.Id {
+			for _, w := range windows {
+				if w.Workspace.Id == ws.Id && len(w.Grouped) > 0 {
+					direction = best_direction(window, w)
+					break
+				}
+			}
+		}
 		cmds = append(cmds,
-			switch_to_worksapce(target_workspace.Name),
-			focus_window(active_window.Address),
-			move_window_in_direction(active_window.Address, "l", true),
-			switch_to_worksapce(active_workspace.Name),
+			switch_to_worksapce(ws.Name),
+			focus_window(window.Address),
+			move_window_in_direction(window.Address, direction, true),
 		)
-	} else if target_workspace.Windows == 0 {
-		// single window in target workspace so put it in stack layout
+	case others == 0:
+		// single window in workspace so put it in stack layout
 		cmds = append(cmds,
-			switch_to_worksapce(target_workspace.Name),
-			focus_window(active_window.Address),
-			make_window_into_group(active_window.Address),
-			switch_to_worksapce(active_workspace.Name),
+			switch_to_worksapce(ws.Name),
+			focus_window(window.Address),
+			make_window_into_group(window.Address),
 		)
+	default:
+		return nil
+	}
+	if return_to != ws.Name {
+		cmds = append(cmds, switch_to_worksapce(return_to))
 	}
-	if _, err = send_commands(cmds...); err != nil {
+	return
+}
+
+// move the window managing the window stacks in source and description
+// workspaces, switching to the workspace return_to afterwards. The window
+// joins the stack in the target workspace only if join is true.
+func move_to_workspace(active_workspace Workspace, active_window Window, target_workspace Workspace, windows []Window, return_to string, join bool) (err error) {
+	if active_workspace.Id == target_workspace.Id {
+		return
+	}
+	cmds := []DispatchCommand{}
+	active_window_was_grouped := len(active_window.Grouped) > 0
+	if active_window_was_grouped {
+		cmds = append(cmds, make_window_into_group(active_window.Address))
+	}
+	cmds = append(cmds, movetoworkspacesilent(active_window.Address, target_workspace.Name))
+	if join {
+		moved := active_window
+		moved.Grouped = nil
+		cmds = append(cmds, join_stack(moved, target_workspace, windows, return_to)...)
+	}
+	if err = dispatch_commands(cmds...); err != nil {
 		return
 	}
 	if active_window_was_grouped {
@@ -481,19 +455,25 @@ func MoveToWorkspace(name string) (err error) {
 	); err != nil {
 		return
 	}
-	for _, w := range workspaces {
-		if w.Name == name {
-			return move_to_workspace(active_workspace, active_window, w, windows)
+	target := WorkspaceName(name)
+	if name == common.WorkspaceBackAndForth {
+		// the name of the previous workspace is not known so its stacks cannot be managed
+		target = PreviousWorkspace
+	} else {
+		for _, w := range workspaces {
+			if w.Name == name {
+				return move_to_workspace(active_workspace, active_window, w, windows, active_workspace.Name, true)
+			}
 		}
 	}
 	// empty workspace, just move unconditionally
-	cmds := []string{}
+	cmds := []DispatchCommand{}
 	active_window_was_grouped := len(active_window.Grouped) > 0
 	if active_window_was_grouped {
 		cmds = append(cmds, make_window_into_group(active_window.Address))
 	}
-	cmds = append(cmds, movetoworkspacesilent(name))
-	if _, err = send_commands(cmds...); err != nil {
+	cmds = append(cmds, Dispatch.MoveWindowToWorkspace(ActiveWindow, target, true))
+	if err = dispatch_commands(cmds...); err != nil {
 		return
 	}
 	if active_window_was_grouped {
@@ -503,13 +483,72 @@ func MoveToWorkspace(name string) (err error) {
 	return
 }
 
+func ApplyWindowActions(id string, actions common.WindowActions) (err error) {
+	var workspaces []Workspace
+	var active_workspace Workspace
+	var windows []Window
+	if err = make_requests(request{"workspaces", &workspaces}, request{"activeworkspace", &active_workspace}, request{"clients", &windows}); err != nil {
+		return
+	}
+	idx := slices.IndexFunc(windows, func(w Window) bool { return w.Address == id })
+	if idx < 0 {
+		return fmt.Errorf("No window with address: %s", id)
+	}
+	window := windows[idx]
+	addr := WindowAddress(id)
+	cmds := []DispatchCommand{}
+	if actions.Floating != nil && *actions.Floating != window.Floating {
+		cmds = append(cmds, Dispatch.ToggleFloating(addr))
+	}
+	if actions.Width > 0 && actions.Height > 0 {
+		cmds = append(cmds, Dispatch.ResizeWindow(addr, actions.Width, actions.Height))
+	}
+	if actions.Fullscreen && window.Fullscreen == 0 {
+		cmds = append(cmds, Dispatch.ToggleFullscreen(addr))
+	}
+	if len(cmds) > 0 {
+		if err = dispatch_commands(cmds...); err != nil {
+			return
+		}
+	}
+	floating := window.Floating
+	if actions.Floating != nil {
+		floating = *actions.Floating
+	}
+	if actions.Workspace != "" && actions.Workspace != window.Workspace.Name {
+		for _, ws := range workspaces {
+			if ws.Name == actions.Workspace {
+				var source Workspace
+				source.Id, source.Name = window.Workspace.Id, window.Workspace.Name
+				// only tiled windows join the stack, and only if the target is stacked
+				stacked := slices.ContainsFunc(windows, func(w Window) bool {
+					return w.Workspace.Id == ws.Id && !w.Floating && len(w.Grouped) > 0
+				})
+				return move_to_workspace(source, window, ws, windows, active_workspace.Name, stacked && !floating)
+			}
+		}
+		return dispatch_commands(movetoworkspacesilent(id, actions.Workspace))
+	}
+	if actions.Stack && !floating {
+		for _, ws := range workspaces {
+			if ws.Id == window.Workspace.Id {
+				if cmds = join_stack(window, ws, windows, active_workspace.Name); len(cmds) > 0 {
+					err = dispatch_commands(cmds...)
+				}
+				break
+			}
+		}
+	}
+	return
+}
+
 func SuperTab() (err error) {
 	var window Window
 	if err = make_requests(request{"activewindow", &window}); err != nil {
 		return
 	}
-	cmd := utils.IfElse(len(window.Grouped) > 1, "eval hl.dispatch(hl.dsp.group.next())", "eval hl.dispatch(hl.dsp.window.cycle_next())")
-	_, err = send_commands(cmd)
+	cmd := utils.IfElse(len(window.Grouped) > 1, Dispatch.Group.Next(), Dispatch.CycleNext())
+	err = dispatch_commands(cmd)
 	return
 }
 
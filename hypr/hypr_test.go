@@ -0,0 +1,957 @@
+package hypr
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"wm/common"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// geometry returns the position and size of the windows, by address
+func geometry(windows []Window) map[string][4]int {
+	ans := make(map[string][4]int, len(windows))
+	for _, w := range windows {
+		ans[w.Address] = [4]int{w.At[0], w.At[1], w.Size[0], w.Size[1]}
+	}
+	return ans
+}
+
+func windows_by_address(windows []Window) map[string]Window {
+	ans := make(map[string]Window, len(windows))
+	for _, w := range windows {
+		ans[w.Address] = w
+	}
+	return ans
+}
+
+func sorted(x []string) []string {
+	x = slices.Clone(x)
+	slices.Sort(x)
+	return x
+}
+
+func TestGetWindowRegions(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	h.add_window("firefox", "two", "1")
+	h.add_window("kitty", "elsewhere", "2")
+	h.focus(a.Address)
+	regions, err := GetWindowRegions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.WindowRegion{{X: 0, Y: 0, Width: 100, Height: 100, Label: "one"}, {X: 100, Y: 0, Width: 100, Height: 100, Label: "two"}}
+	if diff := cmp.Diff(expected, regions); diff != "" {
+		t.Fatalf("Unexpected window regions:\n%s", diff)
+	}
+}
+
+func TestGetPIDsForGracefulShutdown(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("firefox", "two", "2")
+	if diff := cmp.Diff([]int{a.Pid, b.Pid}, GetPIDsForGracefulShutdown()); diff != "" {
+		t.Fatalf("Unexpected pids:\n%s", diff)
+	}
+}
+
+func TestToggleStack(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("firefox", "two", "1")
+	f := h.add_window("kitty", "floating", "1")
+	h.lock.Lock()
+	f.Floating = true
+	h.lock.Unlock()
+	h.add_window("kitty", "elsewhere", "2")
+	h.focus(b.Address)
+	before, _ := h.snapshot()
+
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	windows, active := h.snapshot()
+	w := windows_by_address(windows)
+	if diff := cmp.Diff(sorted([]string{a.Address, b.Address}), sorted(w[a.Address].Grouped)); diff != "" {
+		t.Fatalf("Windows not stacked:\n%s", diff)
+	}
+	if diff := cmp.Diff(w[a.Address].Grouped, w[b.Address].Grouped); diff != "" {
+		t.Fatalf("Windows not in the same stack:\n%s", diff)
+	}
+	if len(w[f.Address].Grouped) != 0 {
+		t.Fatalf("Floating window was stacked")
+	}
+	if active != b.Address {
+		t.Fatalf("Active window changed to: %s", active)
+	}
+
+	// and unstack
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	windows, active = h.snapshot()
+	for _, w := range windows {
+		if len(w.Grouped) != 0 {
+			t.Fatalf("Window still grouped after unstacking: %s", w)
+		}
+	}
+	if active != b.Address {
+		t.Fatalf("Active window changed to: %s", active)
+	}
+	if diff := cmp.Diff(geometry(before), geometry(windows)); diff != "" {
+		t.Fatalf("Layout not restored:\n%s", diff)
+	}
+}
+
+func TestLayoutTree(t *testing.T) {
+	var describe func(n *layout_node) string
+	describe = func(n *layout_node) string {
+		if n == nil {
+			return "nil"
+		}
+		if n.window != "" {
+			return n.window
+		}
+		return "(" + describe(n.first) + " " + n.direction + " " + describe(n.second) + ")"
+	}
+	w := func(addr string, x, y, width, height int) saved_window {
+		return saved_window{addr, [2]int{x, y}, [2]int{width, height}}
+	}
+	for _, tc := range []struct {
+		windows  []saved_window
+		expected string
+	}{
+		{[]saved_window{w("a", 0, 0, 1920, 1080)}, "a"},
+		// dwindle spiral with gaps
+		{[]saved_window{
+			w("a", 5, 5, 950, 1070), w("b", 965, 5, 950, 530),
+			w("c", 965, 545, 470, 530), w("d", 1445, 545, 470, 530),
+		}, "(a r (b d (c r d)))"},
+		// a grid
+		{[]saved_window{
+			w("d", 960, 540, 960, 540), w("a", 0, 0, 960, 540),
+			w("b", 960, 0, 960, 540), w("c", 0, 540, 960, 540),
+		}, "((a d c) r (b d d))"},
+		// not made by splitting
+		{[]saved_window{
+			w("a", 0, 0, 200, 100), w("b", 200, 0, 100, 200),
+			w("c", 100, 200, 200, 100), w("d", 0, 100, 100, 200), w("e", 100, 100, 100, 100),
+		}, "nil"},
+	} {
+		if actual := describe(layout_tree(tc.windows)); actual != tc.expected {
+			t.Fatalf("Wrong layout tree for %v: %s != %s", tc.windows, actual, tc.expected)
+		}
+	}
+}
+
+func TestToggleStackRestoresLayout(t *testing.T) {
+	h := new_fake_hyprland(t)
+	for _, title := range []string{"one", "two", "three", "four"} {
+		h.add_window("kitty", title, "1")
+	}
+	windows, _ := h.snapshot()
+	h.focus(windows[0].Address)
+	before, _ := h.snapshot()
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	// the stack is remembered across changes in window order
+	h.lock.Lock()
+	slices.Reverse(h.windows)
+	h.relayout(windows[0].Workspace.Id)
+	h.lock.Unlock()
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	after, active := h.snapshot()
+	if diff := cmp.Diff(geometry(before), geometry(after)); diff != "" {
+		t.Fatalf("Layout not restored:\n%s", diff)
+	}
+	if active != windows[0].Address {
+		t.Fatalf("Active window changed to: %s", active)
+	}
+
+	// when the windows change the active window is made master instead
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	h.lock.Lock()
+	w := h.window(windows[3].Address)
+	h.remove_from_group(w)
+	w.Floating = true
+	h.lock.Unlock()
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if d := h.received_dispatches(); d[len(d)-1] != fmt.Sprintf("window.move(direction=l, group_aware=false, window=address:%s)", windows[0].Address) {
+		t.Fatalf("Active window not made master, dispatches: %v", d)
+	}
+	after, _ = h.snapshot()
+	for _, w := range after {
+		if len(w.Grouped) != 0 {
+			t.Fatalf("Window still grouped after unstacking: %s", w)
+		}
+	}
+}
+
+func TestToggleStackRestoreFailure(t *testing.T) {
+	h := new_fake_hyprland(t)
+	for _, title := range []string{"one", "two", "three", "four"} {
+		h.add_window("kitty", title, "1")
+	}
+	windows, _ := h.snapshot()
+	h.focus(windows[0].Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(saved_layouts_path()); err != nil || !strings.HasPrefix(saved_layouts_path(), RuntimeDir()) {
+		t.Fatalf("Layout not saved in the instance runtime directory: %s", err)
+	}
+	// restoring fails partway, so the windows are un-grouped instead
+	h.lock.Lock()
+	h.failing_dispatchers = map[string]bool{"group.toggle": true}
+	h.lock.Unlock()
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if d := h.received_dispatches(); d[len(d)-1] != fmt.Sprintf("window.move(direction=l, group_aware=false, window=address:%s)", windows[0].Address) {
+		t.Fatalf("Active window not made master, dispatches: %v", d)
+	}
+	after, _ := h.snapshot()
+	for _, w := range after {
+		if len(w.Grouped) != 0 {
+			t.Fatalf("Window still grouped after unstacking: %s", w)
+		}
+	}
+}
+
+func TestToggleStackEmptyWorkspace(t *testing.T) {
+	h := new_fake_hyprland(t)
+	h.add_window("kitty", "elsewhere", "2")
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if d := h.received_dispatches(); len(d) != 0 {
+		t.Fatalf("Unexpected dispatches: %v", d)
+	}
+}
+
+func TestCandidateDirections(t *testing.T) {
+	directions := func(src, dest rect) (ans []string) {
+		for _, c := range candidate_directions(src, dest) {
+			ans = append(ans, c.direction)
+		}
+		return
+	}
+	for _, tc := range []struct {
+		src, dest rect
+		expected  []string
+	}{
+		// side by side with gaps
+		{rect{970, 0, 1920, 1080}, rect{0, 0, 950, 1080}, []string{"l"}},
+		{rect{0, 0, 950, 1080}, rect{970, 0, 1920, 1080}, []string{"r"}},
+		// top right window above a full width window, to its left is a
+		// window that is not in the stack
+		{rect{970, 0, 1920, 530}, rect{0, 550, 1920, 1080}, []string{"d", "l"}},
+		// nested dwindle: bottom right quarter with the stack on the left
+		// half, the window to its left is not in the stack
+		{rect{1440, 540, 1920, 1080}, rect{0, 0, 960, 1080}, []string{"l", "u"}},
+		// master layout: third window on the right stack
+		{rect{960, 720, 1920, 1080}, rect{0, 0, 960, 1080}, []string{"l", "u"}},
+		{rect{0, 0, 100, 100}, rect{0, 0, 100, 100}, nil},
+	} {
+		if diff := cmp.Diff(tc.expected, directions(tc.src, tc.dest)); diff != "" {
+			t.Fatalf("Wrong directions from %v to %v:\n%s", tc.src, tc.dest, diff)
+		}
+	}
+}
+
+func TestToggleStackNestedLayout(t *testing.T) {
+	h := new_fake_hyprland(t)
+	h.fixed_layout = true
+	x := h.add_window("kitty", "top left", "1")
+	w := h.add_window("kitty", "top right", "1")
+	g := h.add_window("kitty", "bottom", "1")
+	h.lock.Lock()
+	x.At, x.Size = [2]int{0, 0}, [2]int{960, 540}
+	w.At, w.Size = [2]int{960, 0}, [2]int{960, 540}
+	g.At, g.Size = [2]int{0, 540}, [2]int{1920, 540}
+	h.lock.Unlock()
+	h.focus(g.Address)
+	// comparing only positions would move the top right window left, into
+	// the top left window instead of down into the stack
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	windows, active := h.snapshot()
+	if diff := cmp.Diff(sorted([]string{x.Address, w.Address, g.Address}), sorted(windows_by_address(windows)[g.Address].Grouped)); diff != "" {
+		t.Fatalf("Windows not stacked:\n%s", diff)
+	}
+	if active != g.Address {
+		t.Fatalf("Active window changed to: %s", active)
+	}
+}
+
+func TestToggleStackRetriesAndGivesUp(t *testing.T) {
+	// a move that does not join the group is retried in another direction
+	h := new_fake_hyprland(t)
+	h.fixed_layout = true
+	h.ignored_directions = map[string]bool{"d": true}
+	w := h.add_window("kitty", "top right", "1")
+	g := h.add_window("kitty", "bottom", "1")
+	h.lock.Lock()
+	w.At, w.Size = [2]int{960, 0}, [2]int{960, 540}
+	g.At, g.Size = [2]int{0, 540}, [2]int{1920, 540}
+	h.lock.Unlock()
+	h.focus(g.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ := h.snapshot()
+	if diff := cmp.Diff(sorted([]string{w.Address, g.Address}), sorted(windows_by_address(windows)[g.Address].Grouped)); diff != "" {
+		t.Fatalf("Windows not stacked:\n%s", diff)
+	}
+	moves := utils.Filter(h.received_dispatches(), func(d string) bool { return strings.HasPrefix(d, "window.move(direction=") })
+	if diff := cmp.Diff([]string{
+		fmt.Sprintf("window.move(direction=d, group_aware=true, window=address:%s)", w.Address),
+		fmt.Sprintf("window.move(direction=l, group_aware=true, window=address:%s)", w.Address),
+	}, moves); diff != "" {
+		t.Fatalf("Unexpected moves:\n%s", diff)
+	}
+
+	// when no move works the attempts are bounded and an error is reported
+	h = new_fake_hyprland(t)
+	h.ignored_directions = map[string]bool{"l": true, "r": true, "u": true, "d": true}
+	h.add_window("kitty", "one", "1")
+	h.add_window("kitty", "two", "1")
+	a := h.add_window("kitty", "three", "1")
+	h.focus(a.Address)
+	err := ToggleStack()
+	if err == nil || !strings.Contains(err.Error(), "Failed to move the windows") {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	moves = utils.Filter(h.received_dispatches(), func(d string) bool { return strings.HasPrefix(d, "window.move(direction=") })
+	if len(moves) == 0 || len(moves) > 2*max_stack_attempts_per_window {
+		t.Fatalf("Unexpected number of moves: %d", len(moves))
+	}
+	if !strings.Contains(err.Error(), fmt.Sprintf("after %d attempts", len(moves))) {
+		t.Fatalf("Error does not report the %d attempts made: %v", len(moves), err)
+	}
+}
+
+func TestMoveToWorkspace(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("firefox", "two", "1")
+	h.focus(a.Address)
+
+	// moving to a new workspace just moves the window
+	if err := MoveToWorkspace("3"); err != nil {
+		t.Fatal(err)
+	}
+	windows, active := h.snapshot()
+	w := windows_by_address(windows)
+	if w[a.Address].Workspace.Name != "3" || len(w[a.Address].Grouped) != 0 {
+		t.Fatalf("Window not moved to new workspace: %s", w[a.Address])
+	}
+	if active != b.Address {
+		t.Fatalf("Focus did not stay on the source workspace, active window: %s", active)
+	}
+
+	// moving to an existing empty workspace puts the window into a stack
+	h.add_window("kitty", "placeholder", "4")
+	h.focus(b.Address)
+	if err := MoveToWorkspace("3"); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ = h.snapshot()
+	w = windows_by_address(windows)
+	if w[b.Address].Workspace.Name != "3" {
+		t.Fatalf("Window not moved: %s", w[b.Address])
+	}
+
+	// moving into a stacked workspace joins the stack
+	h2 := new_fake_hyprland(t)
+	x := h2.add_window("kitty", "x", "1")
+	y := h2.add_window("kitty", "y", "2")
+	h2.focus(y.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	h2.focus(x.Address)
+	if err := MoveToWorkspace("2"); err != nil {
+		t.Fatal(err)
+	}
+	windows, active = h2.snapshot()
+	w = windows_by_address(windows)
+	if w[x.Address].Workspace.Name != "2" {
+		t.Fatalf("Window not moved: %s", w[x.Address])
+	}
+	if diff := cmp.Diff(sorted([]string{x.Address, y.Address}), sorted(w[x.Address].Grouped)); diff != "" {
+		t.Fatalf("Window did not join the stack:\n%s", diff)
+	}
+	if ws := h2.active_workspace_name(); ws != "1" {
+		t.Fatalf("Focus did not return to the source workspace, active workspace: %s", ws)
+	}
+
+	// moving a window out of a stack regroups the remaining windows
+	h3 := new_fake_hyprland(t)
+	p := h3.add_window("kitty", "p", "1")
+	q := h3.add_window("kitty", "q", "1")
+	h3.focus(p.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveToWorkspace("5"); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ = h3.snapshot()
+	w = windows_by_address(windows)
+	if w[p.Address].Workspace.Name != "5" || len(w[p.Address].Grouped) != 0 {
+		t.Fatalf("Window not moved out of stack: %s", w[p.Address])
+	}
+	if diff := cmp.Diff([]string{q.Address}, w[q.Address].Grouped); diff != "" {
+		t.Fatalf("Remaining window not regrouped:\n%s", diff)
+	}
+}
+
+func TestSuperTab(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("kitty", "two", "1")
+	h.focus(a.Address)
+	if err := SuperTab(); err != nil {
+		t.Fatal(err)
+	}
+	if _, active := h.snapshot(); active != b.Address {
+		t.Fatalf("SuperTab did not cycle to the next window, active: %s", active)
+	}
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := SuperTab(); err != nil {
+		t.Fatal(err)
+	}
+	if _, active := h.snapshot(); active != a.Address {
+		t.Fatalf("SuperTab did not cycle in the group, active: %s", active)
+	}
+	d := h.received_dispatches()
+	if d[len(d)-1] != "group.next()" {
+		t.Fatalf("SuperTab did not use group.next in a stack: %v", d)
+	}
+}
+
+func TestTogglePower(t *testing.T) {
+	h := new_fake_hyprland(t)
+	if err := TogglePower("off", "HDMI*"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"dpms(action=off, monitor=HDMI-A-1)"}, h.received_dispatches()); diff != "" {
+		t.Fatalf("Unexpected dispatches:\n%s", diff)
+	}
+	if err := TogglePower("on", "nomatch"); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.received_dispatches()) != 1 {
+		t.Fatalf("Dispatch sent for unmatched glob")
+	}
+	if err := TogglePower("on", "["); err == nil {
+		t.Fatalf("No error for invalid glob")
+	}
+}
+
+func TestChangeToWorkspace(t *testing.T) {
+	h := new_fake_hyprland(t)
+	h.add_window("kitty", "one", "1")
+	if err := ChangeToWorkspace("7"); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"focus(workspace=name:7)"}, h.received_dispatches()); diff != "" {
+		t.Fatalf("Unexpected dispatches:\n%s", diff)
+	}
+}
+
+func TestExitHyprland(t *testing.T) {
+	h := new_fake_hyprland(t)
+	if err := ExitHyprland(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"exit()"}, h.received_dispatches()); diff != "" {
+		t.Fatalf("Unexpected dispatches:\n%s", diff)
+	}
+}
+
+func next_event(t *testing.T, events <-chan common.Event) common.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatalf("Event stream closed unexpectedly")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for event")
+	}
+	return nil
+}
+
+func wait_for(t *testing.T, what string, condition func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("firefox", "two", "1")
+	h.focus(a.Address)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(expected common.Event) {
+		t.Helper()
+		if diff := cmp.Diff(expected, next_event(t, events)); diff != "" {
+			t.Fatalf("Unexpected event:\n%s", diff)
+		}
+	}
+	expect(common.WorkspaceFocused{Name: "1", Output: "eDP-1"})
+	expect(common.WindowFocused{Id: a.Address, Class: "kitty", Title: "one"})
+	wait_for(t, "event connection", func() bool { return h.num_event_conns() == 1 })
+
+	h.focus(b.Address)
+	expect(common.WindowFocused{Id: b.Address, Class: "firefox", Title: "two"})
+	h.emit("windowtitlev2>>"+b.Address[2:]+",new title", "focusedmon>>HDMI-A-1,3", "submap>>resize", "bell>>")
+	expect(common.TitleChanged{Id: b.Address, Title: "new title"})
+	expect(common.WorkspaceFocused{Name: "3", Output: "HDMI-A-1"})
+	expect(common.ModeChanged{Mode: "resize"})
+	expect(common.Bell{})
+	h.emit("monitoradded>>DP-2", "openwindow>>2000,1,mpv,video", "movewindowv2>>2000,2,2", "closewindow>>2000")
+	expect(common.MonitorAdded{Name: "DP-2"})
+	expect(common.WindowOpened{Id: "0x2000", Workspace: "1", Class: "mpv", Title: "video"})
+	expect(common.WindowMoved{Id: "0x2000", Workspace: "2"})
+	expect(common.WindowClosed{Id: "0x2000"})
+	h.emit("togglegroup>>1,2000,2001", "moveintogroup>>2002", "moveoutofgroup>>2002")
+	expect(common.StackChanged{})
+	expect(common.StackChanged{Id: "0x2002"})
+	expect(common.StackChanged{Id: "0x2002"})
+
+	// simulate a Hyprland reload, the stream must reconnect and resync
+	h.disconnect_events()
+	ev := next_event(t, events)
+	if cs, ok := ev.(common.ConnectionState); !ok || cs.Connected {
+		t.Fatalf("Unexpected event after disconnect: %#v", ev)
+	}
+	expect(common.ConnectionState{Connected: true})
+	expect(common.WorkspaceFocused{Name: "1", Output: "eDP-1"})
+	expect(common.WindowFocused{Id: b.Address, Class: "firefox", Title: "two"})
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestWorkspaceNamesAreQuoted(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	h.add_window("kitty", "two", "1")
+	h.focus(a.Address)
+	name := `we"ird\ name`
+	if err := MoveToWorkspace(name); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ := h.snapshot()
+	if w := windows_by_address(windows)[a.Address]; w.Workspace.Name != name {
+		t.Fatalf("Window moved to wrong workspace: %#v", w.Workspace.Name)
+	}
+}
+
+func TestCapabilitiesCache(t *testing.T) {
+	h := new_fake_hyprland(t)
+	forget := func() {
+		capabilities_cache.Lock()
+		defer capabilities_cache.Unlock()
+		clear(capabilities_cache.m)
+	}
+	if c, err := GetCapabilities(); err != nil || !c.Lua_dispatch {
+		t.Fatalf("Unexpected capabilities: %v %v", c, err)
+	}
+	// a new process uses the capabilities cached in the runtime directory
+	forget()
+	h.version = "0.45.2"
+	if c, err := GetCapabilities(); err != nil || !c.Lua_dispatch || c.Version.Version != "0.53.0" {
+		t.Fatalf("Cached capabilities not used: %v %v", c, err)
+	}
+	forget()
+	if err := os.Remove(capabilities_cache_path(RuntimeDir())); err != nil {
+		t.Fatal(err)
+	}
+	if c, err := GetCapabilities(); err != nil || c.Lua_dispatch {
+		t.Fatalf("Capabilities not queried: %v %v", c, err)
+	}
+}
+
+func TestLegacyHyprland(t *testing.T) {
+	h := new_fake_hyprland(t)
+	h.version = "0.45.2"
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("firefox", "two", "1")
+	h.focus(a.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	windows, active := h.snapshot()
+	w := windows_by_address(windows)
+	if diff := cmp.Diff(sorted([]string{a.Address, b.Address}), sorted(w[a.Address].Grouped)); diff != "" {
+		t.Fatalf("Windows not stacked:\n%s", diff)
+	}
+	if active != a.Address {
+		t.Fatalf("Active window changed to: %s", active)
+	}
+	if err := SuperTab(); err != nil {
+		t.Fatal(err)
+	}
+	if _, active = h.snapshot(); active != b.Address {
+		t.Fatalf("SuperTab did not cycle in the group, active: %s", active)
+	}
+	if err := MoveToWorkspace("2"); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ = h.snapshot()
+	if w := windows_by_address(windows)[b.Address]; w.Workspace.Name != "2" {
+		t.Fatalf("Window not moved: %s", w)
+	}
+	if err := ChangeToWorkspace("2"); err != nil {
+		t.Fatal(err)
+	}
+	if ws := h.active_workspace_name(); ws != "2" {
+		t.Fatalf("Workspace not changed, active workspace: %s", ws)
+	}
+	if err := TogglePower("off", "eDP-1"); err != nil {
+		t.Fatal(err)
+	}
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for _, cmd := range h.commands {
+		if !strings.HasPrefix(cmd, "dispatch ") {
+			t.Fatalf("Non legacy command sent: %s", cmd)
+		}
+	}
+	if cmd := h.commands[len(h.commands)-1]; cmd != "dispatch dpms off eDP-1" {
+		t.Fatalf("Unexpected power command: %s", cmd)
+	}
+}
+
+func TestTraceAndReplay(t *testing.T) {
+	trace_path := filepath.Join(t.TempDir(), "trace.jsonl")
+	exercise := func(emit func()) (received []common.Event) {
+		t.Helper()
+		if err := ToggleStack(); err != nil {
+			t.Fatal(err)
+		}
+		if err := MoveToWorkspace("2"); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := Subscribe(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		emit()
+		for range 4 {
+			received = append(received, next_event(t, events))
+		}
+		return
+	}
+
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	h.add_window("firefox", "two", "1")
+	h.focus(a.Address)
+	if err := common.EnableIPCTrace(trace_path); err != nil {
+		t.Fatal(err)
+	}
+	recorded := exercise(func() {
+		wait_for(t, "event connection", func() bool { return h.num_event_conns() == 1 })
+		h.emit("workspace>>2", "submap>>resize")
+	})
+	common.DisableIPCTrace()
+
+	r := new_replay_hyprland(t, trace_path)
+	if n := len(r.replay_events); n != 2 {
+		t.Fatalf("Unexpected number of recorded events: %d", n)
+	}
+	replayed := exercise(func() {})
+	if diff := cmp.Diff(recorded, replayed); diff != "" {
+		t.Fatalf("Replayed events differ:\n%s", diff)
+	}
+	if n := r.unreplayed(); n != 0 {
+		t.Fatalf("%d recorded exchanges were not replayed", n)
+	}
+}
+
+func TestGetState(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("firefox", "two", "1")
+	h.add_window("mpv", "three", "2")
+	h.focus(b.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	s, err := GetState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := s.ActiveWindow()
+	if w == nil || w.Id != b.Address || w.Class != "firefox" || w.Workspace != "1" || w.Output != "eDP-1" {
+		t.Fatalf("Unexpected active window: %v", w)
+	}
+	if len(s.Windows) != 3 {
+		t.Fatalf("Unexpected windows: %v", s.Windows)
+	}
+	if diff := cmp.Diff(sorted([]string{a.Address, b.Address}), sorted(w.Stack)); diff != "" {
+		t.Fatalf("Unexpected stack:\n%s", diff)
+	}
+	if ws := s.ActiveWorkspace(); ws == nil || ws.Name != "1" || ws.Windows != 2 || !ws.Visible {
+		t.Fatalf("Unexpected active workspace: %v", ws)
+	}
+	if len(s.Workspaces) != 2 || len(s.Outputs) != 2 || s.Outputs[0].Current_workspace != "1" || !s.Outputs[0].Focused {
+		t.Fatalf("Unexpected workspaces: %v or outputs: %v", s.Workspaces, s.Outputs)
+	}
+	// windows that are not in the focus history come last
+	h.lock.Lock()
+	h.window(a.Address).Focus_history_id = -1
+	h.lock.Unlock()
+	if s, err = GetState(); err != nil {
+		t.Fatal(err)
+	}
+	order := map[string]int{}
+	for _, w := range s.Windows {
+		order[w.Id] = w.Focus_order
+	}
+	if order[a.Address] != math.MaxInt || order[b.Address] != 0 {
+		t.Fatalf("Unexpected focus order: %v", order)
+	}
+}
+
+func TestToggleScratchpad(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	term := h.add_window("foot", "dropdown", "1")
+	h.focus(a.Address)
+	in_scratchpad := func() bool {
+		windows, _ := h.snapshot()
+		return windows_by_address(windows)[term.Address].Workspace.Name == "special:term"
+	}
+	hidden := func() bool {
+		s, err := GetState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range s.Windows {
+			if w.Id == term.Address {
+				return w.Hidden
+			}
+		}
+		t.Fatalf("Scratchpad window not in state")
+		return false
+	}
+	if err := ToggleScratchpad("term", term.Address); err != nil {
+		t.Fatal(err)
+	}
+	if _, active := h.snapshot(); !in_scratchpad() || h.shown_special_workspace() != "special:term" || active != term.Address {
+		t.Fatalf("Scratchpad not shown, special workspace: %#v active window: %s", h.shown_special_workspace(), active)
+	}
+	if h.active_workspace_name() != "1" {
+		t.Fatalf("Active workspace changed to: %s", h.active_workspace_name())
+	}
+	if hidden() {
+		t.Fatalf("Shown scratchpad window reported as hidden")
+	}
+	if err := ToggleScratchpad("term", term.Address); err != nil {
+		t.Fatal(err)
+	}
+	if !in_scratchpad() || h.shown_special_workspace() != "" {
+		t.Fatalf("Scratchpad not hidden, special workspace: %#v", h.shown_special_workspace())
+	}
+	if !hidden() {
+		t.Fatalf("Hidden scratchpad window not reported as hidden")
+	}
+	// showing again must not move the window again
+	before := len(h.received_dispatches())
+	if err := ToggleScratchpad("term", term.Address); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"workspace.toggle_special(name=term)", "focus(window=address:" + term.Address + ")"}, h.received_dispatches()[before:]); diff != "" {
+		t.Fatalf("Unexpected dispatches:\n%s", diff)
+	}
+}
+
+func TestApplyWindowActions(t *testing.T) {
+	h := new_fake_hyprland(t)
+	x := h.add_window("kitty", "x", "1")
+	y := h.add_window("kitty", "y", "2")
+	h.focus(y.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	h.focus(x.Address)
+	mail := h.add_window("thunderbird", "mail", "1")
+	floating := true
+	// moving to a stacked workspace joins the stack and leaves the focus on the current workspace
+	if err := ApplyWindowActions(mail.Address, common.WindowActions{Workspace: "2"}); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ := h.snapshot()
+	w := windows_by_address(windows)
+	if diff := cmp.Diff(sorted([]string{mail.Address, y.Address}), sorted(w[mail.Address].Grouped)); diff != "" {
+		t.Fatalf("Window did not join the stack:\n%s", diff)
+	}
+	if ws := h.active_workspace_name(); ws != "1" {
+		t.Fatalf("Focus did not return to the current workspace, active workspace: %s", ws)
+	}
+	// stacking in place with no other windows makes a stack
+	z := h.add_window("kitty", "z", "3")
+	if err := ApplyWindowActions(z.Address, common.WindowActions{Stack: true}); err != nil {
+		t.Fatal(err)
+	}
+	p := h.add_window("mpv", "pip", "1")
+	if err := ApplyWindowActions(p.Address, common.WindowActions{Floating: &floating, Width: 640, Height: 360, Fullscreen: true}); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ = h.snapshot()
+	w = windows_by_address(windows)
+	if diff := cmp.Diff([]string{z.Address}, w[z.Address].Grouped); diff != "" {
+		t.Fatalf("Window not stacked:\n%s", diff)
+	}
+	if pw := w[p.Address]; !pw.Floating || pw.Size != [2]int{640, 360} || pw.Fullscreen == 0 {
+		t.Fatalf("Actions not applied: %s", pw)
+	}
+	if ws := h.active_workspace_name(); ws != "1" {
+		t.Fatalf("Focus did not return to the current workspace, active workspace: %s", ws)
+	}
+	// already floating, so not toggled
+	before := len(h.received_dispatches())
+	if err := ApplyWindowActions(p.Address, common.WindowActions{Floating: &floating, Stack: true}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(h.received_dispatches()) - before; n != 0 {
+		t.Fatalf("Unexpected dispatches: %v", h.received_dispatches()[before:])
+	}
+	// floating windows do not join the stack of the target workspace
+	fl := h.add_window("pavucontrol", "volume", "1")
+	if err := ApplyWindowActions(fl.Address, common.WindowActions{Workspace: "2", Floating: &floating}); err != nil {
+		t.Fatal(err)
+	}
+	// tiled windows only join stacks, not lone windows
+	h.add_window("kitty", "lone", "4")
+	tl := h.add_window("kitty", "tiled", "1")
+	if err := ApplyWindowActions(tl.Address, common.WindowActions{Workspace: "4"}); err != nil {
+		t.Fatal(err)
+	}
+	windows, _ = h.snapshot()
+	w = windows_by_address(windows)
+	if fw := w[fl.Address]; fw.Workspace.Name != "2" || !fw.Floating || len(fw.Grouped) != 0 {
+		t.Fatalf("Floating window not moved as is: %s", fw)
+	}
+	if diff := cmp.Diff(sorted([]string{mail.Address, y.Address}), sorted(w[y.Address].Grouped)); diff != "" {
+		t.Fatalf("Stack changed by floating window:\n%s", diff)
+	}
+	if tw := w[tl.Address]; tw.Workspace.Name != "4" || len(tw.Grouped) != 0 {
+		t.Fatalf("Tiled window not moved as is: %s", tw)
+	}
+}
+
+func TestAutoStack(t *testing.T) {
+	h := new_fake_hyprland(t)
+	a := h.add_window("kitty", "one", "1")
+	b := h.add_window("kitty", "two", "1")
+	h.focus(a.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if !load_stacked_workspaces().Has("1") {
+		t.Fatal("Stacked workspace not remembered")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- AutoStack(ctx) }()
+	defer func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}()
+	wait_for(t, "event connection", func() bool { return h.num_event_conns() == 1 })
+	grouped := func(addr string) []string {
+		windows, _ := h.snapshot()
+		return windows_by_address(windows)[addr].Grouped
+	}
+
+	// a new window in the stacked workspace joins the stack
+	c := h.add_window("kitty", "three", "1")
+	h.emit("openwindow>>" + c.Address[2:] + ",1,kitty,three")
+	wait_for(t, "new window to join the stack", func() bool { return len(grouped(c.Address)) == 3 })
+	if diff := cmp.Diff(sorted([]string{a.Address, b.Address, c.Address}), sorted(grouped(a.Address))); diff != "" {
+		t.Fatalf("Unexpected stack:\n%s", diff)
+	}
+	// windows in other workspaces are left alone
+	d := h.add_window("kitty", "four", "2")
+	h.emit("openwindow>>" + d.Address[2:] + ",2,kitty,four")
+
+	// toggling back ungroups and stops auto stacking
+	h.focus(a.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if load_stacked_workspaces().Has("1") {
+		t.Fatal("Unstacked workspace still remembered")
+	}
+	e := h.add_window("kitty", "five", "1")
+	h.emit("openwindow>>" + e.Address[2:] + ",1,kitty,five")
+	// a workspace with a single window becomes a stack that new windows join
+	h.focus(d.Address)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	f := h.add_window("kitty", "six", "2")
+	h.emit("openwindow>>" + f.Address[2:] + ",2,kitty,six")
+	wait_for(t, "new window to join the stack", func() bool { return len(grouped(f.Address)) == 2 })
+	for _, w := range []*Window{a, b, c, e} {
+		if g := grouped(w.Address); len(g) != 0 {
+			t.Fatalf("Window %s still grouped: %v", w.Address, g)
+		}
+	}
+	// closing all windows destroys the workspace and with it the stack, so
+	// the first window of the recreated workspace is not grouped
+	h.lock.Lock()
+	h.windows = slices.DeleteFunc(h.windows, func(w *Window) bool { return w.Workspace.Name == "2" })
+	h.workspaces = slices.DeleteFunc(h.workspaces, func(ws *Workspace) bool { return ws.Name == "2" })
+	h.lock.Unlock()
+	g := h.add_window("kitty", "seven", "2")
+	h.emit("openwindow>>" + g.Address[2:] + ",2,kitty,seven")
+	wait_for(t, "destroyed stack to be forgotten", func() bool { return !load_stacked_workspaces().Has("2") })
+	if gr := grouped(g.Address); len(gr) != 0 {
+		t.Fatalf("Window in a destroyed stacked workspace was grouped: %v", gr)
+	}
+}
@@ -0,0 +1,211 @@
+package hypr
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// The tiled layout of workspaces is saved when ToggleStack stacks them, so
+// that it can be recreated when they are un-stacked. Hyprland does not expose
+// its split tree, so the tree is inferred from the window geometry. Layouts
+// refer to windows by address, so they are saved in the runtime directory of
+// the Hyprland instance, which is removed when it exits.
+
+type saved_window struct {
+	Address string `json:"address"`
+	At      [2]int `json:"at"`
+	Size    [2]int `json:"size"`
+}
+
+func (self saved_window) rect() rect {
+	return rect{self.At[0], self.At[1], self.At[0] + self.Size[0], self.At[1] + self.Size[1]}
+}
+
+// saved_layouts maps workspace names to the layout of their tiled windows
+type saved_layouts map[string][]saved_window
+
+func saved_layouts_path() string {
+	return filepath.Join(RuntimeDir(), "wm-stacked-layouts.json")
+}
+
+func load_saved_layouts() (ans saved_layouts) {
+	if data, err := os.ReadFile(saved_layouts_path()); err == nil {
+		if err = json.Unmarshal(data, &ans); err != nil {
+			ans = nil
+		}
+	}
+	if ans == nil {
+		ans = saved_layouts{}
+	}
+	return
+}
+
+// save_layout records the layout of the workspace, or forgets it if windows is empty
+func save_layout(workspace_name string, windows []Window) error {
+	layouts := load_saved_layouts()
+	if len(windows) == 0 {
+		if _, found := layouts[workspace_name]; !found {
+			return nil
+		}
+		delete(layouts, workspace_name)
+	} else {
+		saved := make([]saved_window, len(windows))
+		for i, w := range windows {
+			saved[i] = saved_window{w.Address, w.At, w.Size}
+		}
+		slices.SortFunc(saved, func(a, b saved_window) int {
+			if a.At[1] != b.At[1] {
+				return a.At[1] - b.At[1]
+			}
+			return a.At[0] - b.At[0]
+		})
+		layouts[workspace_name] = saved
+	}
+	data, _ := json.Marshal(layouts)
+	return os.WriteFile(saved_layouts_path(), data, 0o600)
+}
+
+// layout_node is a node in the split tree of a layout, either a window or a
+// split into two nodes with second in direction from first
+type layout_node struct {
+	window        string
+	first, second *layout_node
+	direction     string
+}
+
+func (self *layout_node) addresses() []string {
+	if self.window != "" {
+		return []string{self.window}
+	}
+	return append(self.first.addresses(), self.second.addresses()...)
+}
+
+// layout_tree infers the split tree from the window rectangles by
+// recursively finding a line that separates them into two sets, trying
+// vertical lines first. Returns nil if there is no such line, which cannot
+// happen for layouts made by splitting windows.
+func layout_tree(windows []saved_window) *layout_node {
+	if len(windows) == 1 {
+		return &layout_node{window: windows[0].Address}
+	}
+	for _, axis := range []struct {
+		direction  string
+		start, end func(rect) int
+	}{
+		{"r", func(r rect) int { return r.left }, func(r rect) int { return r.right }},
+		{"d", func(r rect) int { return r.top }, func(r rect) int { return r.bottom }},
+	} {
+		sorted := slices.Clone(windows)
+		slices.SortStableFunc(sorted, func(a, b saved_window) int { return axis.start(a.rect()) - axis.start(b.rect()) })
+		end := axis.end(sorted[0].rect())
+		for i := 1; i < len(sorted); i++ {
+			if end <= axis.start(sorted[i].rect()) {
+				first, second := layout_tree(sorted[:i]), layout_tree(sorted[i:])
+				if first == nil || second == nil {
+					return nil
+				}
+				return &layout_node{first: first, second: second, direction: axis.direction}
+			}
+			end = max(end, axis.end(sorted[i].rect()))
+		}
+	}
+	return nil
+}
+
+func opposite_direction(d string) string {
+	switch d {
+	case "l":
+		return "r"
+	case "r":
+		return "l"
+	case "u":
+		return "d"
+	}
+	return "u"
+}
+
+// restore_layout splits up the windows of node, which occupy the area of
+// node, recreating the layout of node. in_group is true when the windows
+// are in a group, with anchor one of them, otherwise node is a single window.
+// The windows of the half not containing anchor are moved out of the group,
+// into a new group if there are several, and then both halves are restored
+// recursively. The commands to dissolve the single window groups that remain
+// are added to finish, as they do not change the layout.
+func restore_layout(node *layout_node, anchor string, in_group bool, finish *Batch) (err error) {
+	if node.window != "" {
+		if in_group {
+			finish.Dispatch(make_window_into_group(node.window))
+		}
+		return
+	}
+	keep, carve, direction := node.first, node.second, node.direction
+	if slices.Contains(node.second.addresses(), anchor) {
+		keep, carve, direction = node.second, node.first, opposite_direction(direction)
+	}
+	carved := carve.addresses()
+	b := Batch{}
+	b.Dispatch(focus_window(carved[0]), move_window_in_direction(carved[0], direction, true))
+	if len(carved) > 1 {
+		b.Dispatch(make_window_into_group(carved[0]))
+		for _, addr := range carved[1:] {
+			b.Dispatch(focus_window(addr), move_window_in_direction(addr, direction, true))
+		}
+	}
+	var clients []Window
+	if err = run_batch(b.Query("clients", &clients)); err != nil {
+		return
+	}
+	if len(carved) > 1 {
+		if err = stack_windows(carved[0], carved[1:], clients); err != nil {
+			return
+		}
+	}
+	if err = restore_layout(keep, anchor, true, finish); err != nil {
+		return
+	}
+	return restore_layout(carve, carved[0], len(carved) > 1, finish)
+}
+
+// restore_saved_layout recreates the layout saved for the workspace when it
+// was stacked, returning false if there is no saved layout or the windows
+// have changed since it was saved
+func restore_saved_layout(workspace_name string, clients []Window, active_window Window) (restored bool, err error) {
+	saved := load_saved_layouts()[workspace_name]
+	if len(saved) != len(clients) {
+		return
+	}
+	addresses := utils.NewSet[string](len(clients))
+	for _, c := range clients {
+		addresses.Add(c.Address)
+	}
+	if len(clients[0].Grouped) != len(clients) || slices.ContainsFunc(clients[0].Grouped, func(a string) bool { return !addresses.Has(a) }) {
+		// windows are not all in a single group
+		return
+	}
+	for _, s := range saved {
+		if !addresses.Has(s.Address) {
+			return
+		}
+	}
+	tree := layout_tree(saved)
+	if tree == nil {
+		return
+	}
+	anchor := utils.IfElse(addresses.Has(active_window.Address), active_window.Address, clients[0].Address)
+	b := Batch{}
+	if err = restore_layout(tree, anchor, true, &b); err != nil {
+		return
+	}
+	for _, s := range saved {
+		b.Dispatch(Dispatch.ResizeWindow(WindowAddress(s.Address), s.Size[0], s.Size[1]))
+	}
+	b.Dispatch(focus_window(anchor))
+	return true, run_batch(&b)
+}
@@ -0,0 +1,387 @@
+package hypr
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var _ = fmt.Print
+
+// Event is a parsed event from the Hyprland events socket (socket2). Window
+// addresses are normalized to the 0x prefixed form used in JSON replies.
+// See https://wiki.hypr.land/IPC/ for the event vocabulary.
+type Event interface {
+	EventName() string
+}
+
+// Events {{{
+type WorkspaceEvent struct{ Name string }
+type WorkspaceV2Event struct {
+	Id   int
+	Name string
+}
+type FocusedMonEvent struct{ Monitor, Workspace string }
+type FocusedMonV2Event struct {
+	Monitor      string
+	Workspace_id int
+}
+type ActiveWindowEvent struct{ Class, Title string }
+type ActiveWindowV2Event struct{ Address string }
+type FullscreenEvent struct{ Enabled bool }
+type MonitorRemovedEvent struct{ Name string }
+type MonitorRemovedV2Event struct {
+	Id                int
+	Name, Description string
+}
+type MonitorAddedEvent struct{ Name string }
+type MonitorAddedV2Event struct {
+	Id                int
+	Name, Description string
+}
+type CreateWorkspaceEvent struct{ Name string }
+type CreateWorkspaceV2Event struct {
+	Id   int
+	Name string
+}
+type DestroyWorkspaceEvent struct{ Name string }
+type DestroyWorkspaceV2Event struct {
+	Id   int
+	Name string
+}
+type MoveWorkspaceEvent struct{ Name, Monitor string }
+type MoveWorkspaceV2Event struct {
+	Id            int
+	Name, Monitor string
+}
+type RenameWorkspaceEvent struct {
+	Id       int
+	New_name string
+}
+type ActiveSpecialEvent struct{ Name, Monitor string }
+type ActiveSpecialV2Event struct {
+	Id            int
+	Name, Monitor string
+}
+type ActiveLayoutEvent struct{ Keyboard, Layout string }
+type OpenWindowEvent struct{ Address, Workspace, Class, Title string }
+type CloseWindowEvent struct{ Address string }
+type MoveWindowEvent struct{ Address, Workspace string }
+type MoveWindowV2Event struct {
+	Address      string
+	Workspace_id int
+	Workspace    string
+}
+type OpenLayerEvent struct{ Namespace string }
+type CloseLayerEvent struct{ Namespace string }
+type SubmapEvent struct{ Name string }
+type ChangeFloatingModeEvent struct {
+	Address  string
+	Floating bool
+}
+type UrgentEvent struct{ Address string }
+
+// Owner is 0 for a monitor share and 1 for a window share
+type ScreencastEvent struct {
+	Active bool
+	Owner  int
+}
+type WindowTitleEvent struct{ Address string }
+type WindowTitleV2Event struct{ Address, Title string }
+
+// Created is true when a group was created and false when it was destroyed
+type ToggleGroupEvent struct {
+	Created   bool
+	Addresses []string
+}
+type MoveIntoGroupEvent struct{ Address string }
+type MoveOutOfGroupEvent struct{ Address string }
+type IgnoreGroupLockEvent struct{ Enabled bool }
+type LockGroupsEvent struct{ Locked bool }
+type ConfigReloadedEvent struct{}
+type PinEvent struct {
+	Address string
+	Pinned  bool
+}
+type MinimizedEvent struct {
+	Address   string
+	Minimized bool
+}
+type BellEvent struct{ Address string }
+type CustomEvent struct{ Data string }
+
+// An event not known to this parser, such as from a newer Hyprland
+type UnknownEvent struct{ Name, Payload string }
+
+func (WorkspaceEvent) EventName() string          { return "workspace" }
+func (WorkspaceV2Event) EventName() string        { return "workspacev2" }
+func (FocusedMonEvent) EventName() string         { return "focusedmon" }
+func (FocusedMonV2Event) EventName() string       { return "focusedmonv2" }
+func (ActiveWindowEvent) EventName() string       { return "activewindow" }
+func (ActiveWindowV2Event) EventName() string     { return "activewindowv2" }
+func (FullscreenEvent) EventName() string         { return "fullscreen" }
+func (MonitorRemovedEvent) EventName() string     { return "monitorremoved" }
+func (MonitorRemovedV2Event) EventName() string   { return "monitorremovedv2" }
+func (MonitorAddedEvent) EventName() string       { return "monitoradded" }
+func (MonitorAddedV2Event) EventName() string     { return "monitoraddedv2" }
+func (CreateWorkspaceEvent) EventName() string    { return "createworkspace" }
+func (CreateWorkspaceV2Event) EventName() string  { return "createworkspacev2" }
+func (DestroyWorkspaceEvent) EventName() string   { return "destroyworkspace" }
+func (DestroyWorkspaceV2Event) EventName() string { return "destroyworkspacev2" }
+func (MoveWorkspaceEvent) EventName() string      { return "moveworkspace" }
+func (MoveWorkspaceV2Event) EventName() string    { return "moveworkspacev2" }
+func (RenameWorkspaceEvent) EventName() string    { return "renameworkspace" }
+func (ActiveSpecialEvent) EventName() string      { return "activespecial" }
+func (ActiveSpecialV2Event) EventName() string    { return "activespecialv2" }
+func (ActiveLayoutEvent) EventName() string       { return "activelayout" }
+func (OpenWindowEvent) EventName() string         { return "openwindow" }
+func (CloseWindowEvent) EventName() string        { return "closewindow" }
+func (MoveWindowEvent) EventName() string         { return "movewindow" }
+func (MoveWindowV2Event) EventName() string       { return "movewindowv2" }
+func (OpenLayerEvent) EventName() string          { return "openlayer" }
+func (CloseLayerEvent) EventName() string         { return "closelayer" }
+func (SubmapEvent) EventName() string             { return "submap" }
+func (ChangeFloatingModeEvent) EventName() string { return "changefloatingmode" }
+func (UrgentEvent) EventName() string             { return "urgent" }
+func (ScreencastEvent) EventName() string         { return "screencast" }
+func (WindowTitleEvent) EventName() string        { return "windowtitle" }
+func (WindowTitleV2Event) EventName() string      { return "windowtitlev2" }
+func (ToggleGroupEvent) EventName() string        { return "togglegroup" }
+func (MoveIntoGroupEvent) EventName() string      { return "moveintogroup" }
+func (MoveOutOfGroupEvent) EventName() string     { return "moveoutofgroup" }
+func (IgnoreGroupLockEvent) EventName() string    { return "ignoregrouplock" }
+func (LockGroupsEvent) EventName() string         { return "lockgroups" }
+func (ConfigReloadedEvent) EventName() string     { return "configreloaded" }
+func (PinEvent) EventName() string                { return "pin" }
+func (MinimizedEvent) EventName() string          { return "minimized" }
+func (BellEvent) EventName() string               { return "bell" }
+func (CustomEvent) EventName() string             { return "custom" }
+func (e UnknownEvent) EventName() string          { return e.Name }
+
+// }}}
+
+// Hyprland does not escape commas in event payloads. Fields that can contain
+// commas, such as titles and workspace names, are parsed as the remainder of
+// the payload once the fields that cannot contain commas, such as ids,
+// addresses and monitor names, have been split off.
+
+// split the payload into exactly n fields, the last getting the remainder
+func split_fields(payload string, n int) ([]string, error) {
+	ans := strings.SplitN(payload, ",", n)
+	if len(ans) != n {
+		return nil, fmt.Errorf("expected %d comma separated fields, got %d", n, len(ans))
+	}
+	return ans, nil
+}
+
+// split the payload into exactly n fields, the second last getting the
+// remainder, for payloads where only the last field is known to not contain
+// commas
+func rsplit_fields(payload string, n int) ([]string, error) {
+	idx := strings.LastIndexByte(payload, ',')
+	if idx < 0 {
+		return nil, fmt.Errorf("expected %d comma separated fields, got 1", n)
+	}
+	if n == 2 {
+		return []string{payload[:idx], payload[idx+1:]}, nil
+	}
+	ans, err := split_fields(payload[:idx], n-1)
+	if err != nil {
+		return nil, err
+	}
+	return append(ans, payload[idx+1:]), nil
+}
+
+func parse_bool(x string) (bool, error) {
+	switch x {
+	case "0":
+		return false, nil
+	case "1":
+		return true, nil
+	}
+	return false, fmt.Errorf("%#v is not a valid boolean", x)
+}
+
+// ParseEvent parses a single line, without its trailing newline, from the
+// Hyprland events socket.
+func ParseEvent(line string) (ev Event, err error) {
+	name, payload, found := strings.Cut(line, ">>")
+	if !found {
+		return nil, fmt.Errorf("Invalid event from hyprland: %s", line)
+	}
+	defer func() {
+		if err != nil {
+			ev = nil
+			err = fmt.Errorf("Invalid %s event from hyprland: %#v: %w", name, payload, err)
+		}
+	}()
+	var f []string
+	var id int
+	var b bool
+	fields := func(n int) bool {
+		f, err = split_fields(payload, n)
+		return err == nil
+	}
+	rfields := func(n int) bool {
+		f, err = rsplit_fields(payload, n)
+		return err == nil
+	}
+	atoi := func(x string) bool {
+		id, err = strconv.Atoi(x)
+		return err == nil
+	}
+	boolean := func(x string) bool {
+		b, err = parse_bool(x)
+		return err == nil
+	}
+	addr := normalize_address
+	switch name {
+	case "workspace":
+		return WorkspaceEvent{payload}, nil
+	case "workspacev2":
+		if fields(2) && atoi(f[0]) {
+			return WorkspaceV2Event{id, f[1]}, nil
+		}
+	case "focusedmon":
+		if fields(2) {
+			return FocusedMonEvent{f[0], f[1]}, nil
+		}
+	case "focusedmonv2":
+		if fields(2) && atoi(f[1]) {
+			return FocusedMonV2Event{f[0], id}, nil
+		}
+	case "activewindow":
+		if fields(2) {
+			return ActiveWindowEvent{f[0], f[1]}, nil
+		}
+	case "activewindowv2":
+		return ActiveWindowV2Event{addr(payload)}, nil
+	case "fullscreen":
+		if boolean(payload) {
+			return FullscreenEvent{b}, nil
+		}
+	case "monitorremoved":
+		return MonitorRemovedEvent{payload}, nil
+	case "monitorremovedv2":
+		if fields(3) && atoi(f[0]) {
+			return MonitorRemovedV2Event{id, f[1], f[2]}, nil
+		}
+	case "monitoradded":
+		return MonitorAddedEvent{payload}, nil
+	case "monitoraddedv2":
+		if fields(3) && atoi(f[0]) {
+			return MonitorAddedV2Event{id, f[1], f[2]}, nil
+		}
+	case "createworkspace":
+		return CreateWorkspaceEvent{payload}, nil
+	case "createworkspacev2":
+		if fields(2) && atoi(f[0]) {
+			return CreateWorkspaceV2Event{id, f[1]}, nil
+		}
+	case "destroyworkspace":
+		return DestroyWorkspaceEvent{payload}, nil
+	case "destroyworkspacev2":
+		if fields(2) && atoi(f[0]) {
+			return DestroyWorkspaceV2Event{id, f[1]}, nil
+		}
+	case "moveworkspace":
+		if rfields(2) {
+			return MoveWorkspaceEvent{f[0], f[1]}, nil
+		}
+	case "moveworkspacev2":
+		if rfields(3) && atoi(f[0]) {
+			return MoveWorkspaceV2Event{id, f[1], f[2]}, nil
+		}
+	case "renameworkspace":
+		if fields(2) && atoi(f[0]) {
+			return RenameWorkspaceEvent{id, f[1]}, nil
+		}
+	case "activespecial":
+		if rfields(2) {
+			return ActiveSpecialEvent{f[0], f[1]}, nil
+		}
+	case "activespecialv2":
+		if rfields(3) && atoi(f[0]) {
+			return ActiveSpecialV2Event{id, f[1], f[2]}, nil
+		}
+	case "activelayout":
+		if fields(2) {
+			return ActiveLayoutEvent{f[0], f[1]}, nil
+		}
+	case "openwindow":
+		if fields(4) {
+			return OpenWindowEvent{addr(f[0]), f[1], f[2], f[3]}, nil
+		}
+	case "closewindow":
+		return CloseWindowEvent{addr(payload)}, nil
+	case "movewindow":
+		if fields(2) {
+			return MoveWindowEvent{addr(f[0]), f[1]}, nil
+		}
+	case "movewindowv2":
+		if fields(3) && atoi(f[1]) {
+			return MoveWindowV2Event{addr(f[0]), id, f[2]}, nil
+		}
+	case "openlayer":
+		return OpenLayerEvent{payload}, nil
+	case "closelayer":
+		return CloseLayerEvent{payload}, nil
+	case "submap":
+		return SubmapEvent{payload}, nil
+	case "changefloatingmode":
+		if fields(2) && boolean(f[1]) {
+			return ChangeFloatingModeEvent{addr(f[0]), b}, nil
+		}
+	case "urgent":
+		return UrgentEvent{addr(payload)}, nil
+	case "screencast":
+		if fields(2) && boolean(f[0]) && atoi(f[1]) {
+			return ScreencastEvent{b, id}, nil
+		}
+	case "windowtitle":
+		return WindowTitleEvent{addr(payload)}, nil
+	case "windowtitlev2":
+		if fields(2) {
+			return WindowTitleV2Event{addr(f[0]), f[1]}, nil
+		}
+	case "togglegroup":
+		if fields(2) && boolean(f[0]) {
+			addresses := []string{}
+			for _, x := range strings.Split(f[1], ",") {
+				if x != "" {
+					addresses = append(addresses, addr(x))
+				}
+			}
+			return ToggleGroupEvent{b, addresses}, nil
+		}
+	case "moveintogroup":
+		return MoveIntoGroupEvent{addr(payload)}, nil
+	case "moveoutofgroup":
+		return MoveOutOfGroupEvent{addr(payload)}, nil
+	case "ignoregrouplock":
+		if boolean(payload) {
+			return IgnoreGroupLockEvent{b}, nil
+		}
+	case "lockgroups":
+		if boolean(payload) {
+			return LockGroupsEvent{b}, nil
+		}
+	case "configreloaded":
+		return ConfigReloadedEvent{}, nil
+	case "pin":
+		if fields(2) && boolean(f[1]) {
+			return PinEvent{addr(f[0]), b}, nil
+		}
+	case "minimized":
+		if fields(2) && boolean(f[1]) {
+			return MinimizedEvent{addr(f[0]), b}, nil
+		}
+	case "bell":
+		return BellEvent{addr(payload)}, nil
+	case "custom":
+		return CustomEvent{payload}, nil
+	default:
+		return UnknownEvent{name, payload}, nil
+	}
+	return
+}
@@ -0,0 +1,85 @@
+package hypr
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestParseEvent(t *testing.T) {
+	for line, expected := range map[string]Event{
+		"workspace>>2":                               WorkspaceEvent{Name: "2"},
+		"workspacev2>>2,web":                         WorkspaceV2Event{Id: 2, Name: "web"},
+		"focusedmon>>DP-1,a,b":                       FocusedMonEvent{Monitor: "DP-1", Workspace: "a,b"},
+		"focusedmonv2>>DP-1,3":                       FocusedMonV2Event{Monitor: "DP-1", Workspace_id: 3},
+		"activewindow>>kitty,a, title, with commas":  ActiveWindowEvent{Class: "kitty", Title: "a, title, with commas"},
+		"activewindowv2>>55a1":                       ActiveWindowV2Event{Address: "0x55a1"},
+		"activewindowv2>>":                           ActiveWindowV2Event{},
+		"fullscreen>>0":                              FullscreenEvent{},
+		"fullscreen>>1":                              FullscreenEvent{Enabled: true},
+		"monitorremoved>>DP-1":                       MonitorRemovedEvent{Name: "DP-1"},
+		"monitorremovedv2>>1,DP-1,Dell, Inc. U2720Q": MonitorRemovedV2Event{Id: 1, Name: "DP-1", Description: "Dell, Inc. U2720Q"},
+		"monitoradded>>DP-1":                         MonitorAddedEvent{Name: "DP-1"},
+		"monitoraddedv2>>1,DP-1,Dell U2720Q":         MonitorAddedV2Event{Id: 1, Name: "DP-1", Description: "Dell U2720Q"},
+		"createworkspace>>a,b":                       CreateWorkspaceEvent{Name: "a,b"},
+		"createworkspacev2>>4,a,b":                   CreateWorkspaceV2Event{Id: 4, Name: "a,b"},
+		"destroyworkspace>>a,b":                      DestroyWorkspaceEvent{Name: "a,b"},
+		"destroyworkspacev2>>4,a,b":                  DestroyWorkspaceV2Event{Id: 4, Name: "a,b"},
+		"moveworkspace>>a,b,DP-1":                    MoveWorkspaceEvent{Name: "a,b", Monitor: "DP-1"},
+		"moveworkspacev2>>3,a,b,DP-1":                MoveWorkspaceV2Event{Id: 3, Name: "a,b", Monitor: "DP-1"},
+		"renameworkspace>>3,a,b":                     RenameWorkspaceEvent{Id: 3, New_name: "a,b"},
+		"activespecial>>special:a,b,DP-1":            ActiveSpecialEvent{Name: "special:a,b", Monitor: "DP-1"},
+		"activespecialv2>>-98,special:a,b,DP-1":      ActiveSpecialV2Event{Id: -98, Name: "special:a,b", Monitor: "DP-1"},
+		"activelayout>>at-keyboard,English (US)":     ActiveLayoutEvent{Keyboard: "at-keyboard", Layout: "English (US)"},
+		"openwindow>>55a1,1,kitty,x,y":               OpenWindowEvent{Address: "0x55a1", Workspace: "1", Class: "kitty", Title: "x,y"},
+		"closewindow>>55a1":                          CloseWindowEvent{Address: "0x55a1"},
+		"movewindow>>55a1,a,b":                       MoveWindowEvent{Address: "0x55a1", Workspace: "a,b"},
+		"movewindowv2>>55a1,3,a,b":                   MoveWindowV2Event{Address: "0x55a1", Workspace_id: 3, Workspace: "a,b"},
+		"openlayer>>waybar":                          OpenLayerEvent{Namespace: "waybar"},
+		"closelayer>>waybar":                         CloseLayerEvent{Namespace: "waybar"},
+		"submap>>resize":                             SubmapEvent{Name: "resize"},
+		"submap>>":                                   SubmapEvent{},
+		"changefloatingmode>>55a1,1":                 ChangeFloatingModeEvent{Address: "0x55a1", Floating: true},
+		"urgent>>55a1":                               UrgentEvent{Address: "0x55a1"},
+		"screencast>>1,0":                            ScreencastEvent{Active: true},
+		"windowtitle>>55a1":                          WindowTitleEvent{Address: "0x55a1"},
+		"windowtitlev2>>55a1,x,y":                    WindowTitleV2Event{Address: "0x55a1", Title: "x,y"},
+		"togglegroup>>1,55a1,55a2":                   ToggleGroupEvent{Created: true, Addresses: []string{"0x55a1", "0x55a2"}},
+		"togglegroup>>0,":                            ToggleGroupEvent{Addresses: []string{}},
+		"moveintogroup>>55a1":                        MoveIntoGroupEvent{Address: "0x55a1"},
+		"moveoutofgroup>>55a1":                       MoveOutOfGroupEvent{Address: "0x55a1"},
+		"ignoregrouplock>>1":                         IgnoreGroupLockEvent{Enabled: true},
+		"lockgroups>>0":                              LockGroupsEvent{},
+		"configreloaded>>":                           ConfigReloadedEvent{},
+		"pin>>55a1,1":                                PinEvent{Address: "0x55a1", Pinned: true},
+		"minimized>>55a1,0":                          MinimizedEvent{Address: "0x55a1"},
+		"bell>>55a1":                                 BellEvent{Address: "0x55a1"},
+		"custom>>a>>b,c":                             CustomEvent{Data: "a>>b,c"},
+		"somefutureevent>>x,y":                       UnknownEvent{Name: "somefutureevent", Payload: "x,y"},
+	} {
+		ev, err := ParseEvent(line)
+		if err != nil {
+			t.Fatalf("Failed to parse %#v: %s", line, err)
+		}
+		if diff := cmp.Diff(expected, ev); diff != "" {
+			t.Fatalf("Unexpected result parsing %#v:\n%s", line, diff)
+		}
+		if name, _, _ := strings.Cut(line, ">>"); ev.EventName() != name {
+			t.Fatalf("Event parsed from %#v has the wrong name: %s", line, ev.EventName())
+		}
+	}
+	for _, line := range []string{
+		"workspace", "workspacev2>>x,web", "workspacev2>>2", "focusedmonv2>>DP-1,x", "fullscreen>>2",
+		"monitoraddedv2>>1,DP-1", "moveworkspace>>a", "moveworkspacev2>>x,a,DP-1", "activespecialv2>>-98,DP-1",
+		"openwindow>>55a1,1,kitty", "movewindowv2>>55a1", "changefloatingmode>>55a1,x", "screencast>>1,x",
+		"togglegroup>>2,55a1", "lockgroups>>", "pin>>55a1",
+	} {
+		if _, err := ParseEvent(line); err == nil {
+			t.Fatalf("No error parsing invalid event: %#v", line)
+		}
+	}
+}
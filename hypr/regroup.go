@@ -0,0 +1,166 @@
+package hypr
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// Tiled windows are separated by gaps and borders, so edges closer than this
+// are considered touching
+const adjacency_tolerance = 64
+
+// The number of moves tried per window being stacked before giving up
+const max_stack_attempts_per_window = 6
+
+type rect struct {
+	left, top, right, bottom int
+}
+
+func (self Window) rect() rect {
+	return rect{self.At[0], self.At[1], self.At[0] + self.Size[0], self.At[1] + self.Size[1]}
+}
+
+func (self rect) center() (int, int) {
+	return (self.left + self.right) / 2, (self.top + self.bottom) / 2
+}
+
+func overlap(a0, a1, b0, b1 int) int {
+	return max(0, min(a1, b1)-max(a0, b0))
+}
+
+type candidate_direction struct {
+	direction string
+	// dest shares an edge with src in this direction
+	adjacent bool
+	// the length of the shared edge, or the overlap of the perpendicular
+	// extents if not adjacent
+	overlap int
+	// the distance between the centers along the direction
+	distance int
+}
+
+func (a candidate_direction) cmp(b candidate_direction) int {
+	if a.adjacent != b.adjacent {
+		return utils.IfElse(a.adjacent, -1, 1)
+	}
+	if a.overlap != b.overlap {
+		return b.overlap - a.overlap
+	}
+	return a.distance - b.distance
+}
+
+// candidate_directions returns the directions in which dest lies from src,
+// best first. Directions in which dest is adjacent to src come first, as a
+// move in them lands in dest, ordered by the length of the shared edge. In
+// nested layouts dest is often not adjacent in the direction its position
+// suggests, which is why all directions in which it lies are returned.
+func candidate_directions(src, dest rect) (ans []candidate_direction) {
+	sx, sy := src.center()
+	dx, dy := dest.center()
+	for _, d := range []struct {
+		direction       string
+		gap, dist, perp int
+	}{
+		{"l", src.left - dest.right, sx - dx, overlap(src.top, src.bottom, dest.top, dest.bottom)},
+		{"r", dest.left - src.right, dx - sx, overlap(src.top, src.bottom, dest.top, dest.bottom)},
+		{"u", src.top - dest.bottom, sy - dy, overlap(src.left, src.right, dest.left, dest.right)},
+		{"d", dest.top - src.bottom, dy - sy, overlap(src.left, src.right, dest.left, dest.right)},
+	} {
+		if d.dist <= 0 {
+			continue
+		}
+		ans = append(ans, candidate_direction{
+			direction: d.direction, distance: d.dist, overlap: d.perp,
+			adjacent: d.perp > 0 && d.gap >= -adjacency_tolerance && d.gap <= adjacency_tolerance,
+		})
+	}
+	slices.SortStableFunc(ans, candidate_direction.cmp)
+	return
+}
+
+// best_direction returns the direction to move src in to reach dest
+func best_direction(src, dest Window) string {
+	if c := candidate_directions(src.rect(), dest.rect()); len(c) > 0 {
+		return c[0].direction
+	}
+	return "l"
+}
+
+// stack_windows moves the windows into the group of the anchor window, which
+// must already be a group. clients is the current list of clients. After
+// every move the clients are queried again to verify that the window joined
+// the group, trying alternative directions for windows that did not. Windows
+// that are closed, floated or moved to another workspace meanwhile are
+// ignored.
+func stack_windows(anchor string, addresses []string, clients []Window) (err error) {
+	pending := utils.NewSet[string](len(addresses))
+	pending.AddItems(addresses...)
+	// directions tried for each window since the last successful move
+	tried := map[string]*utils.Set[string]{}
+	budget := max_stack_attempts_per_window * pending.Len()
+	attempts := 0
+	for ; ; attempts++ {
+		by_address := make(map[string]Window, len(clients))
+		for _, c := range clients {
+			by_address[c.Address] = c
+		}
+		a, found := by_address[anchor]
+		if !found {
+			return fmt.Errorf("The window %s being stacked into has disappeared", anchor)
+		}
+		in_group := utils.NewSet[string](len(a.Grouped))
+		in_group.AddItems(a.Grouped...)
+		for _, addr := range pending.AsSlice() {
+			w, found := by_address[addr]
+			if in_group.Has(addr) || !found || w.Floating || w.Workspace.Id != a.Workspace.Id {
+				pending.Discard(addr)
+				delete(tried, addr)
+			}
+		}
+		if pending.Len() == 0 {
+			return nil
+		}
+		if attempts >= budget {
+			break
+		}
+		// pick the untried move most likely to land in the group
+		var best_window string
+		var best candidate_direction
+		for _, addr := range pending.AsSlice() {
+			for _, c := range candidate_directions(by_address[addr].rect(), a.rect()) {
+				if t := tried[addr]; t != nil && t.Has(c.direction) {
+					continue
+				}
+				if best_window == "" || c.cmp(best) < 0 || (c.cmp(best) == 0 && addr < best_window) {
+					best_window, best = addr, c
+				}
+				break
+			}
+		}
+		if best_window == "" {
+			break
+		}
+		if tried[best_window] == nil {
+			tried[best_window] = utils.NewSet[string]()
+		}
+		tried[best_window].Add(best.direction)
+		clients = nil
+		if err = run_batch(new(Batch).Dispatch(move_window_in_direction(best_window, best.direction, true)).Query("clients", &clients)); err != nil {
+			return
+		}
+		for _, c := range clients {
+			if c.Address == anchor && slices.Contains(c.Grouped, best_window) {
+				// the layout has changed so directions that failed before might work now
+				clear(tried)
+			}
+		}
+	}
+	remaining := pending.AsSlice()
+	slices.Sort(remaining)
+	return fmt.Errorf("Failed to move the windows: %s into the stack of %s after %d attempts", strings.Join(remaining, ", "), anchor, attempts)
+}
@@ -0,0 +1,107 @@
+package hypr
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+func GetState() (ans common.State, err error) {
+	var clients []Window
+	var workspaces []Workspace
+	var monitors []Monitor
+	var active_window Window
+	var active_workspace Workspace
+	if err = make_requests(
+		request{"clients", &clients}, request{"workspaces", &workspaces}, request{"monitors all", &monitors},
+		request{"activewindow", &active_window}, request{"activeworkspace", &active_workspace},
+	); err != nil {
+		return
+	}
+	monitor_names := make(map[int]string, len(monitors))
+	visible := make(map[int]bool, len(monitors))
+	for _, m := range monitors {
+		monitor_names[m.Id] = m.Name
+		if !m.Disabled {
+			visible[m.Active_workspace.Id] = true
+			if m.Special_workspace.Id != 0 {
+				visible[m.Special_workspace.Id] = true
+			}
+		}
+		ans.Outputs = append(ans.Outputs, common.Output{
+			Name: m.Name, Description: m.Description, Make: m.Make, Model: m.Model, Serial: m.Serial,
+			X: m.X, Y: m.Y, Width: m.Width, Height: m.Height,
+			Scale: m.Scale, Refresh_rate: m.Refresh_rate, Focused: m.Focused, Enabled: !m.Disabled, Powered: m.DPMS_status,
+			Current_workspace: m.Active_workspace.Name,
+		})
+	}
+	for _, ws := range workspaces {
+		ans.Workspaces = append(ans.Workspaces, common.Workspace{
+			Id: ws.Id, Name: ws.Name, Output: ws.Monitor, Focused: ws.Id == active_workspace.Id, Visible: visible[ws.Id], Windows: ws.Windows,
+			Special: ws.Id < 0,
+		})
+	}
+	slices.SortFunc(ans.Workspaces, func(a, b common.Workspace) int { return a.Id - b.Id })
+	for _, w := range clients {
+		if !w.Mapped {
+			continue
+		}
+		ans.Windows = append(ans.Windows, common.Window{
+			Id: w.Address, Class: w.Class, Title: w.Title, Initial_class: w.Initial_class, Initial_title: w.Initial_title, Xwayland: w.Xwayland, Pid: w.Pid, Workspace: w.Workspace.Name, Output: monitor_names[w.Monitor],
+			X: w.At[0], Y: w.At[1], Width: w.Size[0], Height: w.Size[1], Floating: w.Floating, Fullscreen: w.Fullscreen != 0,
+			Focused: active_window.Address != "" && w.Address == active_window.Address, Stack: w.Grouped,
+			// windows not in the focus history have a negative id
+			Focus_order: utils.IfElse(w.Focus_history_id < 0, math.MaxInt, w.Focus_history_id),
+			// special workspaces have negative ids
+			Hidden: w.Workspace.Id < 0 && !visible[w.Workspace.Id],
+		})
+	}
+	return
+}
+
+// FocusedStack returns the windows in the group of the active window
+func FocusedStack() (ans []common.Window, err error) {
+	var clients []Window
+	var active_window Window
+	if err = make_requests(request{"activewindow", &active_window}, request{"clients", &clients}); err != nil {
+		return
+	}
+	for _, addr := range active_window.Grouped {
+		if idx := slices.IndexFunc(clients, func(w Window) bool { return w.Address == addr }); idx > -1 {
+			ans = append(ans, common.Window{Id: addr, Class: clients[idx].Class, Title: clients[idx].Title})
+		}
+	}
+	return
+}
+
+func FocusWindow(id string) error {
+	return dispatch_commands(Dispatch.Focus(WindowAddress(id)))
+}
+
+func ToggleScratchpad(name, window_id string) (err error) {
+	var monitors []Monitor
+	var clients []Window
+	if err = make_requests(request{"monitors", &monitors}, request{"clients", &clients}); err != nil {
+		return
+	}
+	special := "special:" + name
+	for _, m := range monitors {
+		if m.Focused && m.Special_workspace.Name == special {
+			// shown, so hide it
+			return dispatch_commands(Dispatch.ToggleSpecialWorkspace(name))
+		}
+	}
+	cmds := []DispatchCommand{}
+	for _, w := range clients {
+		if w.Address == window_id && w.Workspace.Name != special {
+			cmds = append(cmds, Dispatch.MoveWindowToWorkspace(WindowAddress(window_id), SpecialWorkspace(name), true))
+		}
+	}
+	cmds = append(cmds, Dispatch.ToggleSpecialWorkspace(name), Dispatch.Focus(WindowAddress(window_id)))
+	return dispatch_commands(cmds...)
+}
@@ -0,0 +1,125 @@
+package hypr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+type Version struct {
+	Branch         string   `json:"branch"`
+	Commit         string   `json:"commit"`
+	Version        string   `json:"version"`
+	Dirty          bool     `json:"dirty"`
+	Commit_message string   `json:"commit_message"`
+	Commit_date    string   `json:"commit_date"`
+	Tag            string   `json:"tag"`
+	Flags          []string `json:"flags"`
+}
+
+func (c Version) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+// Number returns the release number, for example: [0, 41, 2]. Older releases
+// dont report version so it is parsed from tag, which looks like v0.40.0-90-gabcdef
+func (self Version) Number() (ans [3]int, ok bool) {
+	v := utils.IfElse(self.Version != "", self.Version, self.Tag)
+	v = strings.TrimPrefix(v, "v")
+	v, _, _ = strings.Cut(v, "-")
+	parts := strings.Split(v, ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return
+	}
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return
+		}
+		ans[i] = n
+	}
+	return ans, true
+}
+
+// The first Hyprland release whose control socket accepts eval with the Lua
+// hl.dispatch() API, Hyprland v0.53.0, which replaced hyprlang with Lua for
+// configuration. Earlier releases only understand the classic dispatch
+// keyword syntax and reply "unknown request" to eval.
+var first_lua_dispatch_version = [3]int{0, 53, 0}
+
+type Capabilities struct {
+	Version      Version
+	Lua_dispatch bool
+}
+
+func capabilities_for(v Version) (ans Capabilities) {
+	ans.Version = v
+	if n, ok := v.Number(); ok {
+		ans.Lua_dispatch = slices.Compare(n[:], first_lua_dispatch_version[:]) >= 0
+	} else {
+		// development builds with unparseable versions are assumed to be recent
+		ans.Lua_dispatch = true
+	}
+	return
+}
+
+var capabilities_cache = struct {
+	sync.Mutex
+	m map[string]Capabilities
+}{m: make(map[string]Capabilities)}
+
+// capabilities_cache_path returns the file the capabilities are cached in so
+// that every invocation does not need to query the version. It is in the
+// runtime directory of the Hyprland instance, which is specific to its
+// HYPRLAND_INSTANCE_SIGNATURE and removed when it exits.
+func capabilities_cache_path(instance_dir string) string {
+	return filepath.Join(instance_dir, "wm-capabilities.json")
+}
+
+// get_capabilities returns the capabilities of the Hyprland instance with the
+// specified runtime directory, from the cache or by querying its version
+func get_capabilities(instance_dir string, query_version func() (Version, error)) (ans Capabilities, err error) {
+	capabilities_cache.Lock()
+	defer capabilities_cache.Unlock()
+	if c, found := capabilities_cache.m[instance_dir]; found {
+		return c, nil
+	}
+	path := capabilities_cache_path(instance_dir)
+	if data, rerr := os.ReadFile(path); rerr == nil && json.Unmarshal(data, &ans) == nil {
+		capabilities_cache.m[instance_dir] = ans
+		return
+	}
+	var v Version
+	if v, err = query_version(); err != nil {
+		return
+	}
+	ans = capabilities_for(v)
+	capabilities_cache.m[instance_dir] = ans
+	if data, merr := json.Marshal(ans); merr == nil {
+		// failing to cache only costs a version query next time
+		os.WriteFile(path, data, 0o600)
+	}
+	return
+}
+
+// GetCapabilities queries the version of the running Hyprland instance to
+// determine what it supports. The result is cached per instance, both in
+// memory and in its runtime directory.
+func GetCapabilities() (ans Capabilities, err error) {
+	var c *Client
+	if c, err = NewClient(); err != nil {
+		return
+	}
+	return c.Capabilities(context.Background())
+}
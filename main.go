@@ -1,22 +1,126 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"syscall"
 
 	"github.com/kovidgoyal/kitty/tools/cli"
 	"github.com/kovidgoyal/kitty/tools/utils"
 
 	"wm/bar"
+	"wm/common"
 	"wm/display"
-	"wm/hypr"
+	"wm/focus"
+	_ "wm/hypr"
+	"wm/pin_workspaces"
+	"wm/query"
 	"wm/quit_session"
+	"wm/rules"
+	"wm/scratchpad"
 	"wm/screenshot"
-	"wm/sway"
+	_ "wm/sway"
 )
 
+func with_compositor(action func(common.Compositor) error) (rc int, err error) {
+	var c common.Compositor
+	if c, err = common.DetectCompositor(); err == nil {
+		err = action(c)
+	}
+	return utils.IfElse(err == nil, 0, 1), err
+}
+
+type move_to_workspace_options struct {
+	AllOutputs bool
+}
+
+type workspace_options struct {
+	AllOutputs, BringHere bool
+}
+
+// with_workspace resolves relative workspace targets to a workspace name and
+// runs action with it, doing nothing if there is no suitable workspace
+func with_workspace(target string, all_outputs bool, action func(c common.Compositor, name string) error) (rc int, err error) {
+	return with_compositor(func(c common.Compositor) (err error) {
+		name := target
+		if target != common.WorkspaceBackAndForth && slices.Contains(common.WorkspaceTargets, target) {
+			var state common.State
+			if state, err = c.GetState(); err != nil {
+				return
+			}
+			if name, err = state.ResolveWorkspace(target, all_outputs); err != nil || name == "" {
+				return
+			}
+		}
+		return action(c, name)
+	})
+}
+
+// move_workspace_to_output moves the focused workspace to the output in the
+// specified direction or with the specified name
+func move_workspace_to_output(c common.Compositor, output string) (err error) {
+	state, err := c.GetState()
+	if err != nil {
+		return
+	}
+	ws, here := state.ActiveWorkspace(), state.ActiveOutput()
+	if ws == nil || here == nil {
+		return fmt.Errorf("Could not find the focused workspace and output")
+	}
+	switch d := strings.ToLower(output); d {
+	case "left", "right", "up", "down":
+		o := state.OutputInDirection(here, d)
+		if o == nil {
+			return
+		}
+		output = o.Name
+	default:
+		if !slices.ContainsFunc(state.Outputs, func(o common.Output) bool { return o.Name == output }) {
+			return fmt.Errorf("No output named: %s", output)
+		}
+	}
+	return c.MoveWorkspaceToOutput(ws.Name, output)
+}
+
+type global_options struct {
+	TraceIpc string
+}
+
+// apply_global_options makes the options of the root command take effect
+// before any command is run
+func apply_global_options(root *cli.Command) {
+	var wrap func(*cli.Command)
+	wrap = func(cmd *cli.Command) {
+		if run := cmd.Run; run != nil {
+			cmd.Run = func(cmd *cli.Command, args []string) (rc int, err error) {
+				var opts global_options
+				if err = root.GetOptionValues(&opts); err != nil {
+					return 1, err
+				}
+				if opts.TraceIpc != "" {
+					if err = common.EnableIPCTrace(opts.TraceIpc); err != nil {
+						return 1, err
+					}
+					defer common.DisableIPCTrace()
+				}
+				return run(cmd, args)
+			}
+		}
+		for _, g := range cmd.SubCommandGroups {
+			for _, c := range g.SubCommands {
+				wrap(c)
+			}
+		}
+	}
+	wrap(root)
+}
+
 func main() {
 	root := cli.NewRootCommand()
 	root.ShortDescription = "A tool to ease integration with Wayland compositors"
@@ -26,6 +130,10 @@ func main() {
 		cmd.ShowHelp()
 		return 0, nil
 	}
+	root.Add(cli.OptionSpec{
+		Name: "--trace-ipc",
+		Help: fmt.Sprintf("Log all messages exchanged with the compositor to the specified file in JSON lines format, useful for debugging. Can also be set with the %s environment variable.", common.TRACE_IPC_ENV),
+	})
 
 	root.AddSubCommand(&cli.Command{
 		Name:             "bar",
@@ -62,54 +170,103 @@ func main() {
 			return
 		},
 	}))
+	query.AddEntryPoints(root.AddSubCommand(&cli.Command{
+		Name:             "query",
+		ShortDescription: "Print information about windows, workspaces and outputs as JSON",
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			cmd.ShowHelp()
+			return
+		},
+	}))
+	focus.AddEntryPoints(root)
+	pin_workspaces.AddEntryPoints(root)
+	rules.AddEntryPoints(root.AddSubCommand(&cli.Command{
+		Name:             "rules",
+		ShortDescription: "Apply actions such as moving to a workspace or floating to windows when they are opened",
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			cmd.ShowHelp()
+			return
+		},
+	}))
+	scratchpad.AddEntryPoints(root.AddSubCommand(&cli.Command{
+		Name:             "scratchpad",
+		ShortDescription: "Show and hide named scratchpad windows, such as dropdown terminals",
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			cmd.ShowHelp()
+			return
+		},
+	}))
 	root.AddSubCommand(&cli.Command{
 		Name:             "togglestack",
-		ShortDescription: "Toggle stacked layout in Hyprland since it doesnt have this functionality builtin",
+		ShortDescription: "Toggle stacked layout for the current workspace, emulated with groups in Hyprland since it doesnt have this functionality builtin",
 		OnlyArgsAllowed:  true,
 		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
-			return hypr.ToggleStackMain(args)
+			return with_compositor(func(c common.Compositor) error { return c.ToggleStack() })
 		},
 	})
 	root.AddSubCommand(&cli.Command{
+		Name:             "auto-stack",
+		ShortDescription: "Keep windows arriving in stacked workspaces in the stack",
+		HelpText:         "Keep running, moving windows that are opened in or moved to workspaces stacked with togglestack into the stack of the workspace. Workspaces stay in stack mode, even across restarts, until togglestack is used on them again. Only needed with Hyprland, as sway puts new windows into the stack itself.",
+		OnlyArgsAllowed:  true,
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			if len(args) != 0 {
+				cmd.ShowHelp()
+				return 1, nil
+			}
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			defer cancel()
+			return with_compositor(func(c common.Compositor) error { return c.AutoStack(ctx) })
+		},
+	})
+	workspace_help := fmt.Sprintf("Instead of a workspace name, one of the relative targets: %s can be specified. next and prev cycle through workspaces, the -nonempty variants skip workspaces without windows, back-and-forth is the previously focused workspace, first-empty is the first workspace without windows and new is a new workspace named with the lowest unused number. Relative targets consider only workspaces on the current output, unless --all-outputs is specified.", strings.Join(common.WorkspaceTargets, ", "))
+	add_workspace_options := func(cmd *cli.Command) *cli.Command {
+		cmd.Add(cli.OptionSpec{Name: "--all-outputs", Type: "bool-set", Help: "Consider workspaces on all outputs when resolving relative targets"})
+		return cmd
+	}
+	ws_cmd := add_workspace_options(root.AddSubCommand(&cli.Command{
 		Name:             "workspace",
-		Usage:            " workspace_name",
+		Usage:            " workspace_name | move-to-output left|right|up|down|output_name",
 		ShortDescription: "Change to the specified workspace",
-		OnlyArgsAllowed:  true,
+		HelpText:         workspace_help + " With move-to-output, the focused workspace is moved to the output in the specified direction or with the specified name.",
 		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			var opts workspace_options
+			if err = cmd.GetOptionValues(&opts); err != nil {
+				return 1, err
+			}
+			if len(args) == 2 && args[0] == "move-to-output" {
+				return with_compositor(func(c common.Compositor) error { return move_workspace_to_output(c, args[1]) })
+			}
 			if len(args) != 1 {
 				cmd.ShowHelp()
 				return 1, nil
 			}
-			switch {
-			case hypr.IsHyprlandRunning():
-				err = hypr.ChangeToWorkspace(args[0])
-			case sway.IsSwayRunning():
-				err = sway.ChangeToWorkspace(args[0])
-			default:
-				err = fmt.Errorf("No supported Wayland compositor is running")
-			}
-			return utils.IfElse(err == nil, 0, 1), err
+			return with_workspace(args[0], opts.AllOutputs, func(c common.Compositor, name string) error {
+				if opts.BringHere && name != common.WorkspaceBackAndForth {
+					return c.BringWorkspaceHere(name)
+				}
+				return c.ChangeToWorkspace(name)
+			})
 		},
-	})
-	root.AddSubCommand(&cli.Command{
+	}))
+	ws_cmd.Add(cli.OptionSpec{Name: "--bring-here", Type: "bool-set", Help: "Show the workspace on the focused output, swapping it with the workspace shown here if it is visible on another output"})
+	add_workspace_options(root.AddSubCommand(&cli.Command{
 		Name:             "move-to-workspace",
 		Usage:            " workspace_name",
 		ShortDescription: "Move the active window to the specified workspace",
-		OnlyArgsAllowed:  true,
+		HelpText:         workspace_help,
 		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			var opts move_to_workspace_options
+			if err = cmd.GetOptionValues(&opts); err != nil {
+				return 1, err
+			}
 			if len(args) != 1 {
 				cmd.ShowHelp()
 				return 1, nil
 			}
-			switch {
-			case hypr.IsHyprlandRunning():
-				err = hypr.MoveToWorkspace(args[0])
-			default:
-				err = fmt.Errorf("No supported Wayland compositor is running")
-			}
-			return utils.IfElse(err == nil, 0, 1), err
+			return with_workspace(args[0], opts.AllOutputs, func(c common.Compositor, name string) error { return c.MoveToWorkspace(name) })
 		},
-	})
+	}))
 
 	root.AddSubCommand(&cli.Command{
 		Name:             "super-tab",
@@ -120,10 +277,7 @@ func main() {
 				cmd.ShowHelp()
 				return 1, nil
 			}
-			if err = hypr.SuperTab(); err != nil {
-				rc = 1
-			}
-			return
+			return with_compositor(func(c common.Compositor) error { return c.SuperTab() })
 		},
 	})
 	const BELOW_DEFAULT = 0
@@ -166,6 +320,7 @@ func main() {
 			return
 		},
 	})
+	apply_global_options(root)
 	root.ExecArgs(os.Args)
 
 }
@@ -0,0 +1,128 @@
+package pin_workspaces
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/cli"
+)
+
+var _ = fmt.Print
+
+// Outputs are added and removed in bursts, for example when docking, so wait
+// for things to settle before moving workspaces
+var settle_delay = 500 * time.Millisecond
+
+type options struct {
+	Daemon bool
+}
+
+type move struct {
+	Workspace, Output string
+}
+
+// plan returns the moves needed to put workspaces on their preferred outputs
+func plan(cfg common.Config, state common.State) (ans []move) {
+	for _, ws := range state.Workspaces {
+		if ws.Special {
+			continue
+		}
+		if output := cfg.PreferredOutput(ws.Name, state.Outputs); output != "" && output != ws.Output {
+			ans = append(ans, move{ws.Name, output})
+		}
+	}
+	return
+}
+
+func apply(c common.Compositor) (err error) {
+	cfg, err := common.LoadConfig()
+	if err != nil {
+		return
+	}
+	if len(cfg.Workspace_outputs) == 0 {
+		return
+	}
+	state, err := c.GetState()
+	if err != nil {
+		return
+	}
+	for _, m := range plan(cfg, state) {
+		if err = c.MoveWorkspaceToOutput(m.Workspace, m.Output); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// daemon applies the preferences whenever outputs are added or removed
+func daemon(c common.Compositor) (err error) {
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	events, err := c.Subscribe(ctx)
+	if err != nil {
+		return
+	}
+	report := func(err error) {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Failed to move workspaces to their preferred outputs:", err)
+		}
+	}
+	report(apply(c))
+	timer := time.NewTimer(settle_delay)
+	timer.Stop()
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			switch e := ev.(type) {
+			case common.MonitorAdded, common.MonitorRemoved:
+				timer.Reset(settle_delay)
+			case common.ConnectionState:
+				// outputs might have changed while disconnected
+				if e.Connected {
+					timer.Reset(settle_delay)
+				}
+			}
+		case <-timer.C:
+			report(apply(c))
+		}
+	}
+}
+
+func AddEntryPoints(root *cli.Command) {
+	root.AddSubCommand(&cli.Command{
+		Name:             "pin-workspaces",
+		ShortDescription: "Move workspaces to their preferred outputs",
+		HelpText:         fmt.Sprintf("The preferred outputs are specified in %s with lines of the form:\n\nworkspace_output workspace_name output_pattern\n\nwhere output_pattern is a glob pattern matched against the name, description, make, model and serial number of outputs. Repeat the line for a workspace to specify fallbacks in order of preference.", common.ConfigPath()),
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			var opts options
+			if err = cmd.GetOptionValues(&opts); err != nil {
+				return 1, err
+			}
+			if len(args) != 0 {
+				cmd.ShowHelp()
+				return 1, nil
+			}
+			c, err := common.DetectCompositor()
+			if err != nil {
+				return 1, err
+			}
+			if opts.Daemon {
+				err = daemon(c)
+			} else {
+				err = apply(c)
+			}
+			if err != nil {
+				return 1, err
+			}
+			return
+		},
+	}).Add(cli.OptionSpec{Name: "--daemon", Type: "bool-set", Help: "Keep running, moving workspaces to their preferred outputs whenever outputs are added or removed"})
+}
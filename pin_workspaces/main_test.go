@@ -0,0 +1,53 @@
+package pin_workspaces
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"wm/common"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestPlan(t *testing.T) {
+	cfg, err := common.ParseConfig(strings.NewReader(`
+# the browser goes on the big screen when docked
+workspace_output web Dell Inc. U2720Q*
+workspace_output web eDP-*
+workspace_output mail HDMI-A-1
+workspace_output chat DP-9
+workspace_output	"my notes"	DP-2
+`), "test.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := common.State{
+		Outputs: []common.Output{
+			{Name: "eDP-1", Enabled: true},
+			{Name: "DP-2", Make: "Dell Inc.", Model: "U2720Q", Serial: "ABC", Enabled: true},
+			{Name: "HDMI-A-1", Enabled: false},
+		},
+		Workspaces: []common.Workspace{
+			{Name: "web", Output: "eDP-1"}, {Name: "mail", Output: "DP-2"}, {Name: "chat", Output: "eDP-1"}, {Name: "1", Output: "DP-2"},
+		},
+	}
+	if diff := cmp.Diff([]move{{"web", "DP-2"}}, plan(cfg, state)); diff != "" {
+		t.Fatalf("Unexpected moves:\n%s", diff)
+	}
+	// undocked
+	state.Outputs = state.Outputs[:1]
+	state.Workspaces[0].Output = "DP-2"
+	if diff := cmp.Diff([]move{{"web", "eDP-1"}}, plan(cfg, state)); diff != "" {
+		t.Fatalf("Unexpected moves:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"DP-2"}, cfg.Workspace_outputs["my notes"]); diff != "" {
+		t.Fatalf("Unexpected outputs for a quoted workspace name:\n%s", diff)
+	}
+	for _, bad := range []string{"workspace_output web", "unknown_setting x", "workspace_output web [x", `workspace_output "web DP-2`} {
+		if _, err := common.ParseConfig(strings.NewReader(bad), "test.conf"); err == nil {
+			t.Fatalf("No error for invalid config: %s", bad)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/cli"
+)
+
+var _ = fmt.Print
+
+type options struct {
+	Format string
+}
+
+// write prints items as JSON or, if format is specified, by executing format
+// as a Go template once per item
+func write(w io.Writer, format string, items []any, is_list bool) (err error) {
+	if format == "" {
+		var data []byte
+		if is_list {
+			data, err = json.MarshalIndent(items, "", "  ")
+		} else {
+			data, err = json.MarshalIndent(items[0], "", "  ")
+		}
+		if err != nil {
+			return
+		}
+		_, err = fmt.Fprintln(w, string(data))
+		return
+	}
+	t, err := template.New("format").Funcs(template.FuncMap{
+		"json": func(x any) (string, error) {
+			data, err := json.Marshal(x)
+			return string(data), err
+		},
+		"join": strings.Join,
+	}).Parse(format)
+	if err != nil {
+		return fmt.Errorf("Invalid --format template: %w", err)
+	}
+	for _, item := range items {
+		if err = t.Execute(w, item); err != nil {
+			return
+		}
+		if _, err = fmt.Fprintln(w); err != nil {
+			return
+		}
+	}
+	return
+}
+
+type query struct {
+	name, description string
+	is_list           bool
+	// returns the items to output, nil if there is nothing to output
+	get func(*common.State) []any
+}
+
+func as_any[T any](x []T) []any {
+	ans := make([]any, len(x))
+	for i, item := range x {
+		ans[i] = item
+	}
+	return ans
+}
+
+var queries = []query{
+	{"windows", "all windows", true, func(s *common.State) []any { return as_any(s.Windows) }},
+	{"workspaces", "all workspaces", true, func(s *common.State) []any { return as_any(s.Workspaces) }},
+	{"outputs", "all outputs (monitors)", true, func(s *common.State) []any { return as_any(s.Outputs) }},
+	{"active-window", "the focused window", false, func(s *common.State) []any {
+		if w := s.ActiveWindow(); w != nil {
+			return []any{*w}
+		}
+		return nil
+	}},
+	{"active-workspace", "the focused workspace", false, func(s *common.State) []any {
+		if ws := s.ActiveWorkspace(); ws != nil {
+			return []any{*ws}
+		}
+		return nil
+	}},
+}
+
+func run(q query, opts options) (rc int, err error) {
+	var c common.Compositor
+	if c, err = common.DetectCompositor(); err != nil {
+		return 1, err
+	}
+	state, err := c.GetState()
+	if err != nil {
+		return 1, err
+	}
+	items := q.get(&state)
+	if !q.is_list && len(items) == 0 {
+		// nothing is focused
+		if opts.Format == "" {
+			fmt.Println("null")
+		}
+		return 1, nil
+	}
+	if err = write(os.Stdout, opts.Format, items, q.is_list); err != nil {
+		return 1, err
+	}
+	return
+}
+
+func AddEntryPoints(query_cmd *cli.Command) {
+	for _, q := range queries {
+		empty := "If nothing is focused, null is printed (nothing with --format) and the exit status is 1."
+		if q.is_list {
+			empty = "If there are none, an empty list is printed (nothing with --format) and the exit status is 0."
+		}
+		cmd := query_cmd.AddSubCommand(&cli.Command{
+			Name:             q.name,
+			ShortDescription: "Print " + q.description,
+			HelpText:         "Print " + q.description + " as JSON. The JSON is the same for all compositors. " + empty,
+			Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+				if len(args) != 0 {
+					cmd.ShowHelp()
+					return 1, nil
+				}
+				var opts options
+				if err = cmd.GetOptionValues(&opts); err != nil {
+					return 1, err
+				}
+				return run(q, opts)
+			},
+		})
+		cmd.Add(cli.OptionSpec{
+			Name: "--format",
+			Help: "A Go template used to format the output instead of JSON. For lists it is applied to each item, printing one line per item. Fields are accessed by their Go names, for example: {{.Class}} {{.Title}}. The functions json and join are available.",
+		})
+	}
+}
@@ -7,9 +7,8 @@ import (
 	"path/filepath"
 	"strings"
 	"time"
-	"wm/hypr"
+	"wm/common"
 	"wm/screenshot"
-	"wm/sway"
 
 	"github.com/kovidgoyal/kitty/tools/tty"
 	"github.com/kovidgoyal/kitty/tools/tui/loop"
@@ -29,11 +28,7 @@ func do_shutdown(action string, pids []int) {
 	// ignore signals so that when parent kitty is killed we are not killed
 	var err error
 	signal.Ignore(unix.SIGHUP, unix.SIGTERM, unix.SIGINT)
-	rdir := os.Getenv("XDG_RUNTIME_DIR")
-	if rdir == "" {
-		rdir = fmt.Sprintf("/run/user/%d", os.Geteuid())
-	}
-	shutdown_action_path := filepath.Join(rdir, "my-session-shutdown-action")
+	shutdown_action_path := filepath.Join(common.RuntimeDir(), "my-session-shutdown-action")
 	payload := ""
 	switch action {
 	case LOGOUT:
@@ -51,11 +46,9 @@ func do_shutdown(action string, pids []int) {
 	}
 	time.Sleep(time.Millisecond * 500)
 	// parent kitty is dead cant print anything
-	switch {
-	case hypr.IsHyprlandRunning():
-		err = hypr.ExitHyprland()
-	case sway.IsSwayRunning():
-		err = sway.ExitSway()
+	var c common.Compositor
+	if c, err = common.DetectCompositor(); err == nil {
+		err = c.Exit()
 	}
 	if err != nil {
 		os.Exit(1)
@@ -63,17 +56,12 @@ func do_shutdown(action string, pids []int) {
 }
 
 func run_loop() {
-	var pids []int
-	var err error
-	switch {
-	case hypr.IsHyprlandRunning():
-		pids = hypr.GetPIDsForGracefulShutdown()
-	case sway.IsSwayRunning():
-		pids = sway.GetPIDsForGracefulShutdown()
-	default:
-		debugprintln("No supported Wayland compositor is running")
+	c, err := common.DetectCompositor()
+	if err != nil {
+		debugprintln(err)
 		os.Exit(1)
 	}
+	pids := c.GetPIDsForGracefulShutdown()
 
 	lp, err := loop.New()
 	if err != nil {
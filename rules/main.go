@@ -0,0 +1,112 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/cli"
+)
+
+var _ = fmt.Print
+
+// rules_file reloads the rules when the file changes
+type rules_file struct {
+	rules   common.WindowRules
+	mtime   time.Time
+	checked bool
+}
+
+func (self *rules_file) get() (common.WindowRules, error) {
+	var mtime time.Time
+	if st, err := os.Stat(common.RulesPath()); err == nil {
+		mtime = st.ModTime()
+	}
+	if !self.checked || !mtime.Equal(self.mtime) {
+		rules, err := common.LoadRules()
+		if err != nil {
+			return self.rules, err
+		}
+		self.rules, self.mtime, self.checked = rules, mtime, true
+	}
+	return self.rules, nil
+}
+
+func apply_rules(c common.Compositor, rules common.WindowRules, id string) (err error) {
+	state, err := c.GetState()
+	if err != nil {
+		return
+	}
+	idx := slices.IndexFunc(state.Windows, func(w common.Window) bool { return w.Id == id })
+	if idx < 0 {
+		// the window was closed already
+		return
+	}
+	if actions, matched := rules.ActionsFor(&state.Windows[idx]); matched && !actions.IsEmpty() {
+		err = c.ApplyWindowActions(id, actions)
+	}
+	return
+}
+
+func daemon() (err error) {
+	rf := rules_file{}
+	if _, err = rf.get(); err != nil {
+		return
+	}
+	c, err := common.DetectCompositor()
+	if err != nil {
+		return
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	events, err := c.Subscribe(ctx)
+	if err != nil {
+		return
+	}
+	for ev := range events {
+		if w, ok := ev.(common.WindowOpened); ok {
+			rules, err := rf.get()
+			if err != nil {
+				fmt.Fprintln(os.Stderr, "Failed to reload window rules, using previous rules:", err)
+			}
+			if err = apply_rules(c, rules, w.Id); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to apply rules to the window %s (%s): %s\n", w.Id, w.Class, err)
+			}
+		}
+	}
+	return
+}
+
+func AddEntryPoints(root *cli.Command) {
+	root.AddSubCommand(&cli.Command{
+		Name:             "daemon",
+		ShortDescription: "Apply window rules to windows as they are opened",
+		HelpText: fmt.Sprintf(`The rules are read from %s, and reloaded when it changes. There is one rule per line, of the form:
+
+criteria => actions
+
+The criteria are key=value pairs, all of which must match. The keys class, title, initial_class, initial_title and parent, the name of the parent process of the window's process, take regular expressions and xwayland takes true or false. Quote values containing spaces with double quotes.
+
+The actions are separated by commas and are: workspace NAME to move the window to the workspace, joining its stack if it has one, float, tile, size WIDTH HEIGHT, fullscreen and stack to make the window join the stack on its workspace. When several rules match a window their actions are combined, with later rules taking precedence. For example:
+
+class=^thunderbird$ => workspace mail, stack
+class=^mpv$ title="Picture in picture" => float, size 640 360
+`, common.RulesPath()),
+		OnlyArgsAllowed: true,
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			if len(args) != 0 {
+				cmd.ShowHelp()
+				return 1, nil
+			}
+			if err = daemon(); err != nil {
+				return 1, err
+			}
+			return
+		},
+	})
+}
@@ -0,0 +1,159 @@
+package scratchpad
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/cli"
+)
+
+var _ = fmt.Print
+
+// How long to wait for a launched command to open its window
+var launch_timeout = 30 * time.Second
+
+// The windows belonging to scratchpads, by scratchpad name. Window ids are
+// only meaningful for the compositor instance they were recorded in.
+type scratchpads struct {
+	Instance string            `json:"instance"`
+	Windows  map[string]string `json:"windows"`
+}
+
+func state_path() string {
+	return filepath.Join(common.RuntimeDir(), "wm-scratchpads.json")
+}
+
+func load(instance string) (ans scratchpads) {
+	if data, err := os.ReadFile(state_path()); err == nil {
+		if err = json.Unmarshal(data, &ans); err != nil || ans.Instance != instance {
+			ans = scratchpads{}
+		}
+	}
+	ans.Instance = instance
+	if ans.Windows == nil {
+		ans.Windows = make(map[string]string)
+	}
+	return
+}
+
+func (self scratchpads) save() error {
+	data, _ := json.Marshal(self)
+	return os.WriteFile(state_path(), data, 0o600)
+}
+
+type options struct {
+	Class string
+}
+
+// wait_for_window returns the id of the first opened window that matches
+func wait_for_window(events <-chan common.Event, matches func(common.WindowOpened) bool) (string, error) {
+	for ev := range events {
+		if w, ok := ev.(common.WindowOpened); ok && matches(w) {
+			return w.Id, nil
+		}
+	}
+	return "", fmt.Errorf("Timed out waiting for the command to open a window")
+}
+
+// launch runs the command and returns the id of the window it opens, which
+// is the first window matching class or, if class is empty, the first
+// window opened by the launched process or one of its descendants
+func launch(c common.Compositor, argv []string, class string) (id string, err error) {
+	criteria, err := common.NewWindowCriteria(class, "", 0, "")
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), launch_timeout)
+	defer cancel()
+	// subscribe before launching so that the window cannot be missed
+	events, err := c.Subscribe(ctx)
+	if err != nil {
+		return
+	}
+	pid, err := common.LaunchDetached(argv)
+	if err != nil {
+		return
+	}
+	return wait_for_window(events, func(ev common.WindowOpened) bool {
+		if criteria.Class != nil {
+			return criteria.Class.MatchString(ev.Class)
+		}
+		// the events do not have the pid of the window
+		state, err := c.GetState()
+		if err != nil {
+			return false
+		}
+		for _, w := range state.Windows {
+			if w.Id == ev.Id {
+				return common.IsDescendantOf(w.Pid, pid)
+			}
+		}
+		return false
+	})
+}
+
+func toggle(name string, argv []string, opts options) (rc int, err error) {
+	c, err := common.DetectCompositor()
+	if err != nil {
+		return 1, err
+	}
+	state, err := c.GetState()
+	if err != nil {
+		return 1, err
+	}
+	pads := load(c.InstanceID())
+	id := pads.Windows[name]
+	if id != "" && !slices.ContainsFunc(state.Windows, func(w common.Window) bool { return w.Id == id }) {
+		// the window was closed
+		id = ""
+	}
+	if id == "" {
+		if len(argv) == 0 {
+			return 1, fmt.Errorf("The scratchpad %#v has no window, specify a command to launch one", name)
+		}
+		if id, err = launch(c, argv, opts.Class); err != nil {
+			return 1, err
+		}
+		pads.Windows[name] = id
+		if err = pads.save(); err != nil {
+			return 1, err
+		}
+	}
+	if err = c.ToggleScratchpad(name, id); err != nil {
+		return 1, err
+	}
+	return
+}
+
+func AddEntryPoints(root *cli.Command) {
+	cmd := root.AddSubCommand(&cli.Command{
+		Name:             "toggle",
+		Usage:            "NAME [-- command [args...]]",
+		ShortDescription: "Show or hide the named scratchpad",
+		HelpText:         "A scratchpad is a window that is hidden until needed and then shown on top of the current workspace, useful for dropdown style terminals and the like. If the scratchpad has no window yet, the command is run and the first window it or its child processes open becomes the window of the scratchpad. Use --class for commands that ask an already running process to open the window. On Hyprland scratchpads are special workspaces and on sway windows in the sway scratchpad, identified by a mark.",
+		Run: func(cmd *cli.Command, args []string) (rc int, err error) {
+			if len(args) > 1 && args[1] == "--" {
+				args = slices.Delete(args, 1, 2)
+			}
+			if len(args) == 0 || args[0] == "" {
+				cmd.ShowHelp()
+				return 1, nil
+			}
+			var opts options
+			if err = cmd.GetOptionValues(&opts); err != nil {
+				return 1, err
+			}
+			return toggle(args[0], args[1:], opts)
+		},
+	})
+	cmd.Add(cli.OptionSpec{
+		Name: "--class",
+		Help: "A regular expression matched against the window class (app_id in sway) to identify the window opened by the command, instead of by the process that opened it",
+	})
+}
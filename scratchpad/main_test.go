@@ -0,0 +1,40 @@
+package scratchpad
+
+import (
+	"fmt"
+	"testing"
+	"wm/common"
+)
+
+var _ = fmt.Print
+
+func TestState(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	pads := load("one")
+	pads.Windows["term"] = "0x1"
+	if err := pads.save(); err != nil {
+		t.Fatal(err)
+	}
+	if id := load("one").Windows["term"]; id != "0x1" {
+		t.Fatalf("Scratchpad window not remembered: %#v", id)
+	}
+	if w := load("two").Windows; len(w) != 0 {
+		t.Fatalf("Scratchpad windows from another compositor instance used: %v", w)
+	}
+}
+
+func TestWaitForWindow(t *testing.T) {
+	events := make(chan common.Event, 4)
+	events <- common.WorkspaceFocused{Name: "1"}
+	events <- common.WindowOpened{Id: "1", Class: "firefox"}
+	events <- common.WindowFocused{Id: "1"}
+	events <- common.WindowOpened{Id: "2", Class: "foot"}
+	matches := func(w common.WindowOpened) bool { return w.Class == "foot" }
+	if id, err := wait_for_window(events, matches); err != nil || id != "2" {
+		t.Fatalf("Unexpected window: %#v error: %v", id, err)
+	}
+	close(events)
+	if _, err := wait_for_window(events, matches); err == nil {
+		t.Fatal("No error when no window was opened")
+	}
+}
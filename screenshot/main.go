@@ -8,8 +8,6 @@ import (
 	"strings"
 	"sync"
 	"wm/common"
-	"wm/hypr"
-	"wm/sway"
 
 	"github.com/kovidgoyal/kitty/kittens/clipboard"
 	"github.com/kovidgoyal/kitty/tools/tty"
@@ -37,16 +35,12 @@ var debugprintln = tty.DebugPrintln
 var encode_clipboard_chunk = clipboard.Encode_bytes
 
 func get_instance_group(which string) string {
-	switch {
-	case hypr.IsHyprlandRunning():
-		return which + "-" + hypr.RuntimeDir()
-	case sway.IsSwayRunning():
-		return which + "-" + sway.SocketAddr()
-	default:
-		fmt.Fprintln(os.Stderr, "No supported Wayland compositor is running")
+	c, err := common.DetectCompositor()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
-	return which
+	return which + "-" + c.InstanceID()
 }
 
 func Draw_lines_in_subframe(lp *loop.Loop, bg_style string, lines ...string) {
@@ -123,15 +117,11 @@ func format_regions_for_slurp(regions []common.WindowRegion) string {
 }
 
 func get_window_regions() (ans []common.WindowRegion, err error) {
-	switch {
-	case hypr.IsHyprlandRunning():
-		ans, err = hypr.GetWindowRegions()
-	case sway.IsSwayRunning():
-		ans, err = sway.GetWindowRegions()
-	default:
-		err = fmt.Errorf("No supported Wayland compositor detected")
+	var c common.Compositor
+	if c, err = common.DetectCompositor(); err != nil {
+		return
 	}
-	return
+	return c.GetWindowRegions()
 }
 
 func run_loop() {
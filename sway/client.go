@@ -0,0 +1,365 @@
+package sway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+var ErrClientClosed = errors.New("The connection to sway has been closed")
+
+type reply struct {
+	msg_type uint32
+	payload  []byte
+	err      error
+}
+
+type pending_request struct {
+	msg_type uint32
+	ch       chan reply
+}
+
+// Client is a connection to the sway IPC socket. It is safe for concurrent
+// use. Replies are matched to requests in the order they were sent, which is
+// the order in which sway answers them, and events received on the
+// connection after a call to Subscribe are delivered to the event handler
+// from a dedicated reader goroutine.
+type Client struct {
+	conn      *net.UnixConn
+	lock      sync.Mutex
+	pending   []pending_request
+	on_event  func(event_type uint32, payload []byte)
+	closed    bool
+	close_err error
+	done      chan struct{}
+	// closed once the reader goroutine has exited and so will make no more
+	// calls to the event handler
+	reader_done chan struct{}
+}
+
+func NewClient() (c *Client, err error) {
+	var conn *net.UnixConn
+	if conn, err = connect_to_sway(); err != nil {
+		return
+	}
+	return new_client(conn), nil
+}
+
+func new_client(conn *net.UnixConn) *Client {
+	c := &Client{conn: conn, done: make(chan struct{}), reader_done: make(chan struct{})}
+	go c.read_loop()
+	return c
+}
+
+func (c *Client) read_loop() {
+	defer close(c.reader_done)
+	for {
+		msg_type, payload, err := read_one_msg(c.conn)
+		if err != nil {
+			c.shutdown(err)
+			return
+		}
+		if msg_type&EVENT_MASK != 0 {
+			c.lock.Lock()
+			on_event := c.on_event
+			c.lock.Unlock()
+			if on_event != nil {
+				on_event(msg_type, payload)
+			}
+			continue
+		}
+		c.lock.Lock()
+		if len(c.pending) == 0 {
+			c.lock.Unlock()
+			debugprintln("Got unexpected reply of type", msg_type, "from sway with no pending request")
+			continue
+		}
+		p := c.pending[0]
+		c.pending = c.pending[1:]
+		c.lock.Unlock()
+		r := reply{msg_type: msg_type, payload: payload}
+		if msg_type != p.msg_type {
+			r.err = fmt.Errorf("Got reply of type: %d from sway for request of type: %d", msg_type, p.msg_type)
+		}
+		p.ch <- r
+	}
+}
+
+func (c *Client) shutdown(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.closed {
+		return
+	}
+	c.closed = true
+	c.close_err = utils.IfElse(err == nil, ErrClientClosed, err)
+	for _, p := range c.pending {
+		p.ch <- reply{err: c.close_err}
+	}
+	c.pending = nil
+	c.conn.Close()
+	close(c.done)
+}
+
+// Close the connection, failing any requests still waiting for a reply.
+func (c *Client) Close() error {
+	c.shutdown(nil)
+	return nil
+}
+
+// Done returns a channel that is closed once the connection to sway is lost
+// or closed.
+func (c *Client) Done() <-chan struct{} { return c.done }
+
+// Err returns the reason the connection was closed or nil if it is still open.
+func (c *Client) Err() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.close_err
+}
+
+// Request sends a message to sway and waits for its reply payload.
+func (c *Client) Request(msg_type uint32, payload []byte) (ans []byte, err error) {
+	ch := make(chan reply, 1)
+	c.lock.Lock()
+	if c.closed {
+		err = c.close_err
+		c.lock.Unlock()
+		return
+	}
+	if err = swaymsg(c.conn, msg_type, payload); err != nil {
+		c.lock.Unlock()
+		return
+	}
+	c.pending = append(c.pending, pending_request{msg_type, ch})
+	c.lock.Unlock()
+	r := <-ch
+	return r.payload, r.err
+}
+
+func (c *Client) request_json(msg_type uint32, payload []byte, ans any) (err error) {
+	var data []byte
+	if data, err = c.Request(msg_type, payload); err != nil {
+		return
+	}
+	if err = json.Unmarshal(data, ans); err != nil {
+		err = fmt.Errorf("Got invalid reply to message of type: %d from sway: %#v with error: %w", msg_type, string(data), err)
+	}
+	return
+}
+
+type success_reply struct {
+	Success bool   `json:"success"`
+	Error   string `json:"error"`
+}
+
+// Subscribe to the specified events, such as workspace, window, output, etc.
+// handler is called from the reader goroutine so it must not block on
+// requests made over this same client.
+func (c *Client) Subscribe(handler func(event_type uint32, payload []byte), events ...string) (err error) {
+	c.lock.Lock()
+	c.on_event = handler
+	c.lock.Unlock()
+	payload, _ := json.Marshal(events)
+	var r success_reply
+	if err = c.request_json(SUBSCRIBE, payload, &r); err != nil {
+		return
+	}
+	if !r.Success {
+		err = fmt.Errorf("Subscribing to sway events: %v failed", events)
+	}
+	return
+}
+
+func (c *Client) GetWorkspaces() (ans []Workspace, err error) {
+	err = c.request_json(GET_WORKSPACES, nil, &ans)
+	return
+}
+
+func (c *Client) GetOutputs() (ans []Output, err error) {
+	err = c.request_json(GET_OUTPUTS, nil, &ans)
+	return
+}
+
+func (c *Client) GetTree() (ans *Node, err error) {
+	ans = &Node{}
+	if err = c.request_json(GET_TREE, nil, ans); err != nil {
+		ans = nil
+	}
+	return
+}
+
+func (c *Client) GetMarks() (ans []string, err error) {
+	err = c.request_json(GET_MARKS, nil, &ans)
+	return
+}
+
+// GetBarIDs returns the ids of all configured bars.
+func (c *Client) GetBarIDs() (ans []string, err error) {
+	err = c.request_json(GET_BAR_CONFIG, nil, &ans)
+	return
+}
+
+func (c *Client) GetBarConfig(id string) (ans BarConfig, err error) {
+	err = c.request_json(GET_BAR_CONFIG, utils.UnsafeStringToBytes(id), &ans)
+	return
+}
+
+func (c *Client) GetVersion() (ans Version, err error) {
+	err = c.request_json(GET_VERSION, nil, &ans)
+	return
+}
+
+func (c *Client) GetBindingModes() (ans []string, err error) {
+	err = c.request_json(GET_BINDING_MODES, nil, &ans)
+	return
+}
+
+// GetBindingState returns the name of the currently active binding mode.
+func (c *Client) GetBindingState() (ans string, err error) {
+	var r struct {
+		Name string `json:"name"`
+	}
+	err = c.request_json(GET_BINDING_STATE, nil, &r)
+	return r.Name, err
+}
+
+// GetConfig returns the contents of the last loaded config file.
+func (c *Client) GetConfig() (ans string, err error) {
+	var r struct {
+		Config string `json:"config"`
+	}
+	err = c.request_json(GET_CONFIG, nil, &r)
+	return r.Config, err
+}
+
+// SendTick sends a tick event with the specified payload to all clients
+// subscribed to tick events.
+func (c *Client) SendTick(payload string) (err error) {
+	var r success_reply
+	if err = c.request_json(SEND_TICK, utils.UnsafeStringToBytes(payload), &r); err != nil {
+		return
+	}
+	if !r.Success {
+		err = fmt.Errorf("Sending tick to sway failed")
+	}
+	return
+}
+
+// Sync is an i3 compatibility message that sway always answers with failure,
+// so the returned success value is reported rather than converted into an
+// error.
+func (c *Client) Sync() (success bool, err error) {
+	var r success_reply
+	err = c.request_json(SYNC, nil, &r)
+	return r.Success, err
+}
+
+func (c *Client) GetInputs() (ans []Input, err error) {
+	err = c.request_json(GET_INPUTS, nil, &ans)
+	return
+}
+
+func (c *Client) GetSeats() (ans []Seat, err error) {
+	err = c.request_json(GET_SEATS, nil, &ans)
+	return
+}
+
+// with_client runs action with a newly connected client, closing it afterwards.
+func with_client(action func(*Client) error) (err error) {
+	var c *Client
+	if c, err = NewClient(); err != nil {
+		return
+	}
+	defer c.Close()
+	return action(c)
+}
+
+// CommandResult is the result of a single command in a RUN_COMMAND batch.
+type CommandResult struct {
+	Command     string `json:"-"`
+	Success     bool   `json:"success"`
+	Parse_error bool   `json:"parse_error"`
+	Error       string `json:"error"`
+}
+
+type CommandError struct {
+	Command, Message string
+	Parse_error      bool
+}
+
+func (e *CommandError) Error() string {
+	if e.Parse_error {
+		return fmt.Sprintf("The sway command: %s could not be parsed: %s", e.Command, e.Message)
+	}
+	return fmt.Sprintf("The sway command: %s failed with error: %s", e.Command, e.Message)
+}
+
+// split_unquoted splits s at sep, ignoring separators inside double quotes
+func split_unquoted(s string, sep byte) (ans []string) {
+	start, in_quote := 0, false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && in_quote:
+			i++
+		case c == '"':
+			in_quote = !in_quote
+		case c == sep && !in_quote:
+			ans = append(ans, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(ans, s[start:])
+}
+
+// RunCommands sends the specified commands to sway as a single ;-separated
+// batch. The returned error joins a *CommandError for every command that
+// failed. sway runs all commands in a batch even if some fail, unless one
+// cannot be parsed, which aborts the rest of the batch, so there may be fewer
+// results than commands. sway returns a result for every ,-separated
+// sub-command, so if any command has sub-commands, results cannot be mapped
+// to commands and the whole batch is reported as the command in results and
+// errors.
+func (c *Client) RunCommands(commands ...string) (results []CommandResult, err error) {
+	if len(commands) == 0 {
+		return
+	}
+	batch := strings.Join(commands, "; ")
+	if err = c.request_json(RUN_COMMAND, utils.UnsafeStringToBytes(batch), &results); err != nil {
+		return
+	}
+	has_sub_commands := slices.ContainsFunc(commands, func(cmd string) bool { return len(split_unquoted(cmd, ',')) > 1 })
+	for i := range results {
+		if has_sub_commands || i >= len(commands) {
+			results[i].Command = batch
+		} else {
+			results[i].Command = commands[i]
+		}
+	}
+	errs := []error{}
+	for _, r := range results {
+		if !r.Success {
+			errs = append(errs, &CommandError{Command: r.Command, Message: r.Error, Parse_error: r.Parse_error})
+		}
+	}
+	if len(results) == 0 {
+		errs = append(errs, fmt.Errorf("Got no results for the sway commands: %s", batch))
+	}
+	return results, errors.Join(errs...)
+}
+
+func RunCommands(commands ...string) (results []CommandResult, err error) {
+	err = with_client(func(c *Client) (err error) {
+		results, err = c.RunCommands(commands...)
+		return
+	})
+	return
+}
@@ -0,0 +1,52 @@
+package sway
+
+import (
+	"context"
+	"fmt"
+	"wm/common"
+)
+
+var _ = fmt.Print
+
+type Sway struct{}
+
+func (Sway) Name() string       { return "sway" }
+func (Sway) InstanceID() string { return SocketAddr() }
+
+func (Sway) ChangeToWorkspace(name string) error  { return ChangeToWorkspace(name) }
+func (Sway) MoveToWorkspace(name string) error    { return MoveToWorkspace(name) }
+func (Sway) BringWorkspaceHere(name string) error { return BringWorkspaceHere(name) }
+func (Sway) ToggleStack() error                   { return ToggleStack() }
+func (Sway) SuperTab() error                      { return SuperTab() }
+
+func (Sway) GetWindowRegions() ([]common.WindowRegion, error) { return GetWindowRegions() }
+func (Sway) GetState() (common.State, error)                  { return GetState() }
+func (Sway) FocusedStack() ([]common.Window, error)           { return FocusedStack() }
+func (Sway) FocusWindow(id string) error                      { return FocusWindow(id) }
+func (Sway) ToggleScratchpad(name, window_id string) error    { return ToggleScratchpad(name, window_id) }
+
+func (Sway) ApplyWindowActions(id string, actions common.WindowActions) error {
+	return ApplyWindowActions(id, actions)
+}
+
+func (Sway) MoveWorkspaceToOutput(workspace, output string) error {
+	return MoveWorkspaceToOutput(workspace, output)
+}
+
+func (Sway) TogglePower(action, output_name_glob string) error {
+	return TogglePower(action, output_name_glob)
+}
+
+func (Sway) Exit() error                       { return ExitSway() }
+func (Sway) GetPIDsForGracefulShutdown() []int { return GetPIDsForGracefulShutdown() }
+
+// sway puts new windows into the stacked container, so there is nothing to do
+func (self Sway) AutoStack(ctx context.Context) error {
+	return common.Unsupported("Auto stacking", self)
+}
+
+func (Sway) Subscribe(ctx context.Context) (<-chan common.Event, error) { return Subscribe(ctx) }
+
+func init() {
+	common.RegisterCompositor("sway", IsSwayRunning, func() common.Compositor { return Sway{} })
+}
@@ -0,0 +1,202 @@
+package sway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+func (self *Node) Class() string {
+	if self.App_id == "" && self.Window_properties != nil {
+		return self.Window_properties.Class
+	}
+	return self.App_id
+}
+
+func (self *Node) Title() string {
+	if self.Name == "" && self.Window_properties != nil {
+		return self.Window_properties.Title
+	}
+	return self.Name
+}
+
+func window_id(n *Node) string {
+	return strconv.Itoa(n.Id)
+}
+
+// event_converter turns sway IPC events into common.Event values. It tracks
+// the set of outputs since sway does not report which output was added or
+// removed.
+type event_converter struct {
+	outputs     *utils.Set[string]
+	get_outputs func() ([]Output, error)
+}
+
+func (self *event_converter) update_outputs() (added, removed []string, err error) {
+	var outputs []Output
+	if outputs, err = self.get_outputs(); err != nil {
+		return
+	}
+	current := utils.NewSet[string](len(outputs))
+	for _, o := range outputs {
+		current.Add(o.Name)
+		if self.outputs != nil && !self.outputs.Has(o.Name) {
+			added = append(added, o.Name)
+		}
+	}
+	if self.outputs != nil {
+		for _, name := range self.outputs.AsSlice() {
+			if !current.Has(name) {
+				removed = append(removed, name)
+			}
+		}
+	}
+	self.outputs = current
+	return
+}
+
+func (self *event_converter) convert(msg_type uint32, payload []byte) (ans []common.Event, err error) {
+	a := func(ev common.Event) { ans = append(ans, ev) }
+	switch msg_type {
+	case EVENT_WORKSPACE:
+		var ev WorkspaceEvent
+		if err = json.Unmarshal(payload, &ev); err != nil {
+			return
+		}
+		if ev.Change == `focus` && ev.Current != nil {
+			a(common.WorkspaceFocused{Name: ev.Current.Name, Output: ev.Current.Output})
+		}
+	case EVENT_WINDOW:
+		var ev WindowEvent
+		if err = json.Unmarshal(payload, &ev); err != nil {
+			return
+		}
+		c := ev.Container
+		if c == nil {
+			return
+		}
+		switch ev.Change {
+		case `focus`:
+			a(common.WindowFocused{Id: window_id(c), Class: c.Class(), Title: c.Title()})
+		case `title`:
+			a(common.TitleChanged{Id: window_id(c), Title: c.Title()})
+		case `new`:
+			a(common.WindowOpened{Id: window_id(c), Class: c.Class(), Title: c.Title()})
+		case `close`:
+			a(common.WindowClosed{Id: window_id(c)})
+		case `move`:
+			a(common.WindowMoved{Id: window_id(c)})
+		case `urgent`:
+			if c.Urgent {
+				a(common.Urgent{Id: window_id(c)})
+			}
+		case `fullscreen_mode`:
+			a(common.Fullscreen{Id: window_id(c), Enabled: c.Fullscreen_mode != 0})
+		}
+	case EVENT_MODE:
+		var ev struct {
+			Change string `json:"change"`
+		}
+		if err = json.Unmarshal(payload, &ev); err != nil {
+			return
+		}
+		a(common.ModeChanged{Mode: ev.Change})
+	case EVENT_OUTPUT:
+		var added, removed []string
+		if added, removed, err = self.update_outputs(); err != nil {
+			return
+		}
+		for _, name := range added {
+			a(common.MonitorAdded{Name: name})
+		}
+		for _, name := range removed {
+			a(common.MonitorRemoved{Name: name})
+		}
+	default:
+		err = fmt.Errorf("Got unknown message type from sway: %x", msg_type)
+	}
+	return
+}
+
+type events_connection struct {
+	client *Client
+	send   func(common.Event)
+}
+
+func (self *events_connection) Resync() (err error) {
+	var workspaces []Workspace
+	var root *Node
+	if workspaces, err = self.client.GetWorkspaces(); err != nil {
+		return
+	}
+	if root, err = self.client.GetTree(); err != nil {
+		return
+	}
+	for _, x := range workspaces {
+		if x.Focused {
+			self.send(common.WorkspaceFocused{Name: x.Name, Output: x.Output})
+		}
+	}
+	if f := root.FindFocused(); f != nil && f.IsView() {
+		self.send(common.WindowFocused{Id: window_id(f), Class: f.Class(), Title: f.Title()})
+	} else {
+		self.send(common.WindowFocused{})
+	}
+	return
+}
+
+func (self *events_connection) Run() error {
+	<-self.client.reader_done
+	return self.client.Err()
+}
+
+func (self *events_connection) Close() { self.client.Close() }
+
+func connect_events(send func(common.Event)) (ans common.EventConnection, err error) {
+	var c *Client
+	if c, err = NewClient(); err != nil {
+		return
+	}
+	// Outputs have to be queried over a separate connection as the
+	// event handler runs in the reader goroutine of c
+	converter := event_converter{get_outputs: func() (ans []Output, err error) {
+		err = with_client(func(c *Client) (err error) {
+			ans, err = c.GetOutputs()
+			return
+		})
+		return
+	}}
+	if _, _, err = converter.update_outputs(); err != nil {
+		c.Close()
+		return
+	}
+	handle_event := func(msg_type uint32, payload []byte) {
+		evs, err := converter.convert(msg_type, payload)
+		if err != nil {
+			debugprintln(fmt.Sprintf("Failed to handle message of type %x from sway with error: %s", msg_type, err))
+		}
+		for _, ev := range evs {
+			send(ev)
+		}
+	}
+	if err = c.Subscribe(handle_event, "workspace", "window", "mode", "output"); err != nil {
+		c.Close()
+		return
+	}
+	return &events_connection{client: c, send: send}, nil
+}
+
+// Subscribe returns a channel of compositor events. The stream starts with
+// events describing the currently focused workspace and window. If the
+// connection to sway is lost it is reconnected with backoff, a
+// common.ConnectionState event is sent and the state is resynced. The
+// channel is closed when ctx is cancelled.
+func Subscribe(ctx context.Context) (events <-chan common.Event, err error) {
+	return common.SuperviseEvents(ctx, connect_events)
+}
@@ -0,0 +1,302 @@
+package sway
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"wm/common"
+
+	"github.com/kovidgoyal/kitty/tools/utils"
+)
+
+var _ = fmt.Print
+
+// fake_sway is an in-process sway IPC server listening on a temporary unix
+// socket that is exported as SWAYSOCK for the duration of a test.
+type fake_sway struct {
+	t        *testing.T
+	listener *net.UnixListener
+	lock     sync.Mutex
+	// canned replies by message type, marshalled to JSON when sent
+	replies map[uint32]any
+	// commands received via RUN_COMMAND, in order
+	commands []string
+	// commands that should fail, mapped to their error message
+	failing_commands map[string]string
+	// commands that should fail to parse, aborting the rest of the batch,
+	// mapped to their error message
+	invalid_commands map[string]string
+	conns            []*fake_conn
+	// when replaying a trace, the recorded exchanges not yet replayed and
+	// the events to send to subscribers
+	replay        []common.IPCExchange
+	replay_events []common.IPCTraceRecord
+	replay_mode   bool
+}
+
+type fake_conn struct {
+	conn       *net.UnixConn
+	write_lock sync.Mutex
+	subscribed *utils.Set[string]
+}
+
+func (c *fake_conn) write(msg_type uint32, payload []byte) error {
+	c.write_lock.Lock()
+	defer c.write_lock.Unlock()
+	return write_msg(c.conn, msg_type, payload)
+}
+
+func new_fake_sway(t *testing.T) *fake_sway {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "sway-ipc.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("SWAYSOCK", path)
+	self := &fake_sway{t: t, listener: l, replies: map[uint32]any{
+		GET_TREE: json.RawMessage(test_tree), GET_WORKSPACES: json.RawMessage(test_workspaces), GET_OUTPUTS: json.RawMessage(test_outputs),
+	}, failing_commands: map[string]string{}, invalid_commands: map[string]string{}}
+	t.Cleanup(self.close)
+	go self.accept_loop()
+	return self
+}
+
+func (self *fake_sway) close() {
+	self.listener.Close()
+	self.disconnect_all()
+}
+
+// disconnect_all closes all client connections, simulating a compositor reload
+func (self *fake_sway) disconnect_all() {
+	self.lock.Lock()
+	conns := self.conns
+	self.conns = nil
+	self.lock.Unlock()
+	for _, c := range conns {
+		c.conn.Close()
+	}
+}
+
+func (self *fake_sway) accept_loop() {
+	for {
+		conn, err := self.listener.AcceptUnix()
+		if err != nil {
+			return
+		}
+		c := &fake_conn{conn: conn, subscribed: utils.NewSet[string]()}
+		self.lock.Lock()
+		self.conns = append(self.conns, c)
+		self.lock.Unlock()
+		go self.serve(c)
+	}
+}
+
+func (self *fake_sway) serve(c *fake_conn) {
+	defer c.conn.Close()
+	for {
+		msg_type, payload, err := read_msg(c.conn)
+		if err != nil {
+			return
+		}
+		if self.replaying() {
+			if self.replay_next(c, msg_type, payload) != nil {
+				return
+			}
+			continue
+		}
+		var reply any
+		switch msg_type {
+		case RUN_COMMAND:
+			reply = self.run_commands(string(payload))
+		case SUBSCRIBE:
+			var events []string
+			if err = json.Unmarshal(payload, &events); err != nil {
+				reply = map[string]any{"success": false}
+			} else {
+				self.lock.Lock()
+				c.subscribed.AddItems(events...)
+				self.lock.Unlock()
+				reply = map[string]any{"success": true}
+			}
+		default:
+			self.lock.Lock()
+			r, found := self.replies[msg_type]
+			self.lock.Unlock()
+			if !found {
+				self.t.Errorf("Fake sway got unexpected message of type: %d", msg_type)
+				return
+			}
+			reply = r
+		}
+		data, _ := json.Marshal(reply)
+		if c.write(msg_type, data) != nil {
+			return
+		}
+	}
+}
+
+// run_commands runs the ;-separated commands, like sway there is a result for
+// every ,-separated sub-command and only parse errors abort the batch
+func (self *fake_sway) run_commands(payload string) (results []CommandResult) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for _, cmd := range split_unquoted(payload, ';') {
+		for _, sub := range split_unquoted(cmd, ',') {
+			sub = strings.TrimSpace(sub)
+			self.commands = append(self.commands, sub)
+			if msg, found := self.invalid_commands[sub]; found {
+				return append(results, CommandResult{Error: msg, Parse_error: true})
+			}
+			if msg, found := self.failing_commands[sub]; found {
+				results = append(results, CommandResult{Error: msg})
+			} else {
+				results = append(results, CommandResult{Success: true})
+			}
+		}
+	}
+	return
+}
+
+func (self *fake_sway) set_reply(msg_type uint32, reply any) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.replies[msg_type] = reply
+}
+
+func (self *fake_sway) received_commands() []string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return append([]string(nil), self.commands...)
+}
+
+// emit sends an event to every connection subscribed to it
+func (self *fake_sway) emit(name string, event_type uint32, payload any) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	self.lock.Lock()
+	conns := utils.Filter(self.conns, func(c *fake_conn) bool { return c.subscribed.Has(name) })
+	self.lock.Unlock()
+	if len(conns) == 0 {
+		return errors.New("no connections subscribed to: " + name)
+	}
+	for _, c := range conns {
+		if err = c.write(event_type, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// A tree with workspace 1:web containing two tiled windows and a floating
+// one and workspace 2 containing a stacked container of two windows.
+const test_tree = `{
+  "id": 1, "name": "root", "type": "root", "layout": "splith", "rect": {"x": 0, "y": 0, "width": 1920, "height": 1080},
+  "focus": [3], "floating_nodes": [],
+  "nodes": [
+    {"id": 2, "name": "__i3", "type": "output", "nodes": [
+      {"id": 3, "name": "__i3_scratch", "type": "workspace", "layout": "splith", "nodes": [], "floating_nodes": []}
+    ], "floating_nodes": []},
+    {"id": 4, "name": "eDP-1", "type": "output", "layout": "output", "focus": [5, 20], "nodes": [
+      {"id": 5, "name": "1:web", "type": "workspace", "num": 1, "output": "eDP-1", "layout": "splith", "focus": [10, 12, 11],
+       "nodes": [
+         {"id": 10, "name": "kitty", "type": "con", "app_id": "kitty", "pid": 100, "visible": true, "focused": true, "layout": "none",
+          "rect": {"x": 0, "y": 0, "width": 960, "height": 1080}, "nodes": [], "floating_nodes": []},
+         {"id": 11, "name": "Mozilla Firefox", "type": "con", "app_id": null, "pid": 101, "visible": true, "layout": "none",
+          "window_properties": {"class": "firefox", "title": "Mozilla Firefox"},
+          "rect": {"x": 960, "y": 0, "width": 960, "height": 1080}, "nodes": [], "floating_nodes": []}
+       ],
+       "floating_nodes": [
+         {"id": 12, "name": "calculator", "type": "floating_con", "app_id": "calc", "pid": 102, "visible": true, "layout": "none",
+          "rect": {"x": 100, "y": 100, "width": 300, "height": 400}, "nodes": [], "floating_nodes": []}
+       ]},
+      {"id": 20, "name": "2", "type": "workspace", "num": 2, "output": "eDP-1", "layout": "splith", "focus": [21],
+       "nodes": [
+         {"id": 21, "name": "", "type": "con", "layout": "stacked", "focus": [23, 22], "nodes": [
+           {"id": 22, "name": "mail", "type": "con", "app_id": "thunderbird", "pid": 200, "visible": false, "layout": "none", "nodes": [], "floating_nodes": []},
+           {"id": 23, "name": "editor", "type": "con", "app_id": "kitty", "pid": 201, "visible": false, "layout": "none", "nodes": [], "floating_nodes": []}
+         ], "floating_nodes": []}
+       ], "floating_nodes": []}
+    ], "floating_nodes": []}
+  ]
+}`
+
+const test_workspaces = `[
+  {"id": 5, "num": 1, "name": "1:web", "visible": true, "focused": true, "output": "eDP-1", "rect": {"x": 0, "y": 0, "width": 1920, "height": 1080}},
+  {"id": 20, "num": 2, "name": "2", "visible": false, "focused": false, "output": "eDP-1", "rect": {"x": 0, "y": 0, "width": 1920, "height": 1080}}
+]`
+
+const test_outputs = `[
+  {"id": 4, "name": "eDP-1", "make": "BOE", "model": "0x0BCA", "serial": "", "active": true, "power": true, "focused": true, "current_workspace": "1:web"},
+  {"id": 6, "name": "HDMI-A-1", "make": "Dell", "model": "U2720Q", "serial": "ABC", "active": true, "power": true, "focused": false, "current_workspace": "3"}
+]`
+
+// new_replay_sway returns a fake sway that answers requests with the
+// responses recorded in the trace file, in order, failing the test if the
+// requests differ from the recorded ones. Recorded events are sent to
+// connections after they subscribe.
+func new_replay_sway(t *testing.T, trace_path string) *fake_sway {
+	t.Helper()
+	records, err := common.ReadIPCTrace(trace_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records = utils.Filter(records, func(r common.IPCTraceRecord) bool { return r.Backend == "sway" })
+	self := new_fake_sway(t)
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.replay_mode = true
+	self.replay, self.replay_events = common.PairIPCTrace(records)
+	return self
+}
+
+func (self *fake_sway) replaying() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.replay_mode
+}
+
+// unreplayed returns the number of recorded exchanges not yet replayed
+func (self *fake_sway) unreplayed() int {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return len(self.replay)
+}
+
+func (self *fake_sway) replay_next(c *fake_conn, msg_type uint32, payload []byte) error {
+	self.lock.Lock()
+	if len(self.replay) == 0 {
+		self.lock.Unlock()
+		self.t.Errorf("Fake sway got message of type: %d with payload: %s after the end of the trace", msg_type, payload)
+		return fmt.Errorf("End of trace")
+	}
+	x := self.replay[0]
+	self.replay = self.replay[1:]
+	var events []common.IPCTraceRecord
+	if msg_type == SUBSCRIBE {
+		events, self.replay_events = self.replay_events, nil
+	}
+	self.lock.Unlock()
+	if *x.Request.Type != msg_type || x.Request.Payload != string(payload) {
+		self.t.Errorf("Request differs from trace\nexpected: %d %s\nactual:   %d %s", *x.Request.Type, x.Request.Payload, msg_type, payload)
+	}
+	if x.Response == nil {
+		return nil
+	}
+	if err := c.write(*x.Response.Type, []byte(x.Response.Payload)); err != nil {
+		return err
+	}
+	for _, ev := range events {
+		if err := c.write(*ev.Type, []byte(ev.Payload)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package sway
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"wm/common"
+)
+
+var _ = fmt.Print
+
+func GetState() (ans common.State, err error) {
+	var root *Node
+	var workspaces []Workspace
+	var outputs []Output
+	if err = with_client(func(c *Client) (err error) {
+		if root, err = c.GetTree(); err != nil {
+			return
+		}
+		if workspaces, err = c.GetWorkspaces(); err != nil {
+			return
+		}
+		outputs, err = c.GetOutputs()
+		return
+	}); err != nil {
+		return
+	}
+	for _, o := range outputs {
+		ans.Outputs = append(ans.Outputs, common.Output{
+			Name: o.Name, Description: strings.Join(strings.Fields(o.Make+" "+o.Model+" "+o.Serial), " "),
+			Make: o.Make, Model: o.Model, Serial: o.Serial,
+			X: o.Rect.X, Y: o.Rect.Y, Width: o.Rect.Width, Height: o.Rect.Height, Scale: o.Scale,
+			Refresh_rate: float64(o.Current_mode.Refresh) / 1000, Focused: o.Focused, Enabled: o.Active, Powered: o.Power,
+			Current_workspace: o.Current_workspace,
+		})
+	}
+	focus_order := map[int]int{}
+	for i, n := range root.FocusOrder() {
+		focus_order[n.Id] = i
+	}
+	window_counts := map[int]int{}
+	for _, ws := range root.Workspaces() {
+		leaves := ws.Leaves()
+		window_counts[ws.Id] = len(leaves)
+		// windows in the scratchpad are not on any workspace until shown
+		hidden := ws.Name == scratch_workspace_name
+		for _, n := range leaves {
+			w := common.Window{
+				// sway does not keep the initial class and title
+				Id: window_id(n), Class: n.Class(), Title: n.Title(), Initial_class: n.Class(), Initial_title: n.Title(), Xwayland: n.Shell == "xwayland", Pid: n.Pid, Workspace: ws.Name, Output: ws.Output,
+				X: n.Rect.X, Y: n.Rect.Y, Width: n.Rect.Width, Height: n.Rect.Height, Floating: n.Type == "floating_con",
+				Fullscreen: n.Fullscreen_mode != 0, Focused: n.Focused, Urgent: n.Urgent, Focus_order: focus_order[n.Id], Hidden: hidden,
+			}
+			if hidden {
+				w.Workspace, w.Output = "", ""
+			}
+			if parent := root.ParentOf(n.Id); parent != nil && parent.IsStacked() {
+				for _, s := range parent.Leaves() {
+					w.Stack = append(w.Stack, window_id(s))
+				}
+			}
+			ans.Windows = append(ans.Windows, w)
+		}
+	}
+	for _, ws := range workspaces {
+		ans.Workspaces = append(ans.Workspaces, common.Workspace{
+			Id: ws.Id, Name: ws.Name, Output: ws.Output, Focused: ws.Focused, Visible: ws.Visible, Windows: window_counts[ws.Id],
+		})
+	}
+	return
+}
+
+// FocusedStack returns the windows in the stacked or tabbed container of the
+// focused window
+func FocusedStack() (ans []common.Window, err error) {
+	var root *Node
+	if root, err = get_tree(); err != nil {
+		return
+	}
+	focused := root.FindFocused()
+	if focused == nil || !focused.IsView() {
+		return
+	}
+	if parent := root.ParentOf(focused.Id); parent != nil && parent.IsStacked() {
+		for _, n := range parent.Leaves() {
+			ans = append(ans, common.Window{Id: window_id(n), Class: n.Class(), Title: n.Title()})
+		}
+	}
+	return
+}
+
+func FocusWindow(id string) (err error) {
+	con_id, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("Invalid sway window id: %#v", id)
+	}
+	_, err = RunCommands(fmt.Sprintf("[con_id=%d] focus", con_id))
+	return
+}
+
+const scratchpad_mark_prefix = "_wm_scratchpad_"
+
+// The name of the workspace holding the windows in the sway scratchpad
+const scratch_workspace_name = "__i3_scratch"
+
+func ToggleScratchpad(name, window_id string) (err error) {
+	con_id, err := strconv.Atoi(window_id)
+	if err != nil {
+		return fmt.Errorf("Invalid sway window id: %#v", window_id)
+	}
+	return with_client(func(c *Client) (err error) {
+		var root *Node
+		if root, err = c.GetTree(); err != nil {
+			return
+		}
+		node := root.Find(func(n *Node) bool { return n.Id == con_id })
+		if node == nil {
+			return fmt.Errorf("No window with id: %d", con_id)
+		}
+		win := fmt.Sprintf("[con_id=%d] ", con_id)
+		var cmds []string
+		mark := scratchpad_mark_prefix + name
+		switch {
+		case !slices.Contains(node.Marks, mark):
+			// not yet in the scratchpad, add it and show it
+			cmds = []string{win + "mark --add " + sway_quote(mark), win + "move scratchpad", win + "scratchpad show"}
+		case node.Visible:
+			// shown so hide it
+			cmds = []string{win + "move scratchpad"}
+		default:
+			// hidden or on a workspace that is not shown, show on the current workspace
+			cmds = []string{win + "scratchpad show"}
+		}
+		_, err = c.RunCommands(cmds...)
+		return
+	})
+}
@@ -3,12 +3,12 @@ package sway
 import (
 	"bytes"
 	"encoding/binary"
-	"encoding/json"
 	"fmt"
 	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"wm/common"
 
@@ -22,13 +22,33 @@ var debugprintln = tty.DebugPrintln
 // See man 7 sway-ipc
 const magic = "i3-ipc"
 const (
-	RUN_COMMAND     = 0
-	GET_WORKSPACES  = 1
-	SUBSCRIBE       = 2
-	GET_OUTPUTS     = 3
-	GET_TREE        = 4
-	EVENT_WORKSPACE = 0x80000000
-	EVENT_WINDOW    = 0x80000003
+	RUN_COMMAND       = 0
+	GET_WORKSPACES    = 1
+	SUBSCRIBE         = 2
+	GET_OUTPUTS       = 3
+	GET_TREE          = 4
+	GET_MARKS         = 5
+	GET_BAR_CONFIG    = 6
+	GET_VERSION       = 7
+	GET_BINDING_MODES = 8
+	GET_CONFIG        = 9
+	SEND_TICK         = 10
+	SYNC              = 11
+	GET_BINDING_STATE = 12
+	GET_INPUTS        = 100
+	GET_SEATS         = 101
+
+	EVENT_MASK             = 0x80000000
+	EVENT_WORKSPACE        = 0x80000000
+	EVENT_OUTPUT           = 0x80000001
+	EVENT_MODE             = 0x80000002
+	EVENT_WINDOW           = 0x80000003
+	EVENT_BARCONFIG_UPDATE = 0x80000004
+	EVENT_BINDING          = 0x80000005
+	EVENT_SHUTDOWN         = 0x80000006
+	EVENT_TICK             = 0x80000007
+	EVENT_BAR_STATE_UPDATE = 0x80000014
+	EVENT_INPUT            = 0x80000015
 )
 
 func SocketAddr() string {
@@ -54,7 +74,26 @@ func connect_to_sway() (conn *net.UnixConn, err error) {
 	return
 }
 
+func trace_msg(conn *net.UnixConn, direction string, msg_type uint32, payload []byte) {
+	if common.IPCTracing() {
+		common.TraceIPC(common.IPCTraceRecord{
+			Backend: "sway", Socket: "ipc", Conn: fmt.Sprintf("%p", conn), Direction: direction, Type: &msg_type, Payload: string(payload)})
+	}
+}
+
 func swaymsg(conn *net.UnixConn, payload_type uint32, payload []byte) (err error) {
+	trace_msg(conn, "send", payload_type, payload)
+	return write_msg(conn, payload_type, payload)
+}
+
+func read_one_msg(conn *net.UnixConn) (msg_type uint32, payload []byte, err error) {
+	if msg_type, payload, err = read_msg(conn); err == nil {
+		trace_msg(conn, "recv", msg_type, payload)
+	}
+	return
+}
+
+func write_msg(conn *net.UnixConn, payload_type uint32, payload []byte) (err error) {
 	buf := new(bytes.Buffer)
 	l := uint32(len(payload))
 	buf.WriteString(magic)
@@ -69,11 +108,15 @@ func swaymsg(conn *net.UnixConn, payload_type uint32, payload []byte) (err error
 	return nil
 }
 
-func read_one_msg(conn *net.UnixConn) (msg_type uint32, payload []byte, err error) {
+func read_msg(conn *net.UnixConn) (msg_type uint32, payload []byte, err error) {
 	header := [14]byte{}
 	if _, err = io.ReadFull(conn, header[:]); err != nil {
 		return
 	}
+	if string(header[:len(magic)]) != magic {
+		err = fmt.Errorf("Got message with invalid magic: %#v from sway", string(header[:len(magic)]))
+		return
+	}
 	h := header[len(magic):]
 	var payload_len uint32
 	binary.Decode(h, binary.NativeEndian, &payload_len)
@@ -85,42 +128,12 @@ func read_one_msg(conn *net.UnixConn) (msg_type uint32, payload []byte, err erro
 	return
 }
 
-func get_tree() (ans map[string]any, err error) {
-	var conn *net.UnixConn
-	if conn, err = connect_to_sway(); err != nil {
-		return
-	}
-	if err = swaymsg(conn, GET_TREE, nil); err != nil {
+func get_tree() (ans *Node, err error) {
+	err = with_client(func(c *Client) (err error) {
+		ans, err = c.GetTree()
 		return
-	}
-	var msg_type uint32
-	var payload []byte
-	if msg_type, payload, err = read_one_msg(conn); err != nil {
-		return
-	}
-	if msg_type != GET_TREE {
-		err = fmt.Errorf("Got message of wrong type: %d from sway", msg_type)
-		return
-	}
-	var x map[string]any
-	if err = json.Unmarshal(payload, &x); err != nil {
-		return
-	}
-	return x, err
-}
-
-func walk_nodes(node map[string]any, callback func(map[string]any)) {
-	callback(node)
-	for _, collection := range []string{"nodes", "floating_nodes"} {
-		if c, ok := node[collection].([]any); ok {
-			for _, child := range c {
-				if cn, ok := child.(map[string]any); ok {
-					walk_nodes(cn, callback)
-				}
-			}
-		}
-	}
-
+	})
+	return
 }
 
 func GetPIDsForGracefulShutdown() []int {
@@ -129,89 +142,36 @@ func GetPIDsForGracefulShutdown() []int {
 		return nil
 	}
 	ans := make([]int, 0, 32)
-	walk_nodes(root, func(node map[string]any) {
-		if pid, ok := node[`pid`].(float64); ok && pid > 0 {
-			if q, ok := node[`type`].(string); ok && q == "con" {
-				if app_id, ok := node[`app_id`].(string); ok && app_id != "" {
-					ans = append(ans, int(pid))
-				}
-			}
+	walk_nodes(root, func(node *Node) {
+		if node.Pid > 0 && node.Type == "con" && node.App_id != "" {
+			ans = append(ans, node.Pid)
 		}
 	})
 	return ans
 }
 
 func TogglePower(action string, output_name_glob string) (err error) {
-	var conn *net.UnixConn
-	conn, err = connect_to_sway()
-	if err != nil {
-		return
-	}
-	if err = swaymsg(conn, GET_OUTPUTS, []byte("exit")); err != nil {
-		return
-	}
-	msg_type, payload, err := read_one_msg(conn)
-	if err != nil {
-		return err
-	}
-	if msg_type != GET_OUTPUTS {
-		err = fmt.Errorf("Got unexpected msg_type in response from sway")
-		return
-	}
-	var x []map[string]any
-	if err = json.Unmarshal(payload, &x); err != nil {
-		return err
-	}
-	for _, m := range x {
-		if name, ok := m[`name`].(string); ok {
-			if matched, err := filepath.Match(output_name_glob, name); err != nil {
+	return with_client(func(c *Client) (err error) {
+		var outputs []Output
+		if outputs, err = c.GetOutputs(); err != nil {
+			return
+		}
+		commands := []string{}
+		for _, m := range outputs {
+			if matched, err := filepath.Match(output_name_glob, m.Name); err != nil {
 				return err
 			} else if matched {
-				if err = swaymsg(conn, RUN_COMMAND, utils.UnsafeStringToBytes(fmt.Sprintf(
-					"output %s power %s", name, action))); err != nil {
-					return err
-				}
+				commands = append(commands, fmt.Sprintf("output %s power %s", m.Name, action))
 			}
 		}
-	}
-
-	return
+		_, err = c.RunCommands(commands...)
+		return
+	})
 }
 
 func ExitSway() (err error) {
-	conn, err := connect_to_sway()
-	if err != nil {
-		return err
-	}
-	if err = swaymsg(conn, RUN_COMMAND, []byte("exit")); err != nil {
-		return
-	}
-	msg_type, payload, err := read_one_msg(conn)
-	if err != nil {
-		return err
-	}
-	if msg_type != RUN_COMMAND {
-		err = fmt.Errorf("Got message of wrong type: %d from sway", msg_type)
-		return err
-	}
-	var x []map[string]any
-	if err = json.Unmarshal(payload, &x); err != nil {
-		return err
-	}
-	if len(x) != 1 {
-		return fmt.Errorf("Got %d responses to exit command", len(x))
-	}
-	res := x[0]
-	if success, ok := res[`success`].(bool); ok {
-		if success {
-			return nil
-		}
-		msg := ""
-		msg, ok = res[`error`].(string)
-		return fmt.Errorf("exit command failed with error: %s", msg)
-	} else {
-		return fmt.Errorf("Got %#v invalid response to exit command", res)
-	}
+	_, err = RunCommands("exit")
+	return
 }
 
 func GetWindowRegions() (regions []common.WindowRegion, err error) {
@@ -219,146 +179,312 @@ func GetWindowRegions() (regions []common.WindowRegion, err error) {
 	if err != nil {
 		return nil, err
 	}
-	walk_nodes(root, func(node map[string]any) {
-		if _, ok := node[`pid`].(float64); ok {
-			if visible, ok := node[`visible`].(bool); ok && visible {
-				if rect, ok := node[`rect`].(map[string]any); ok {
-					regions = append(regions, common.WindowRegion{X: int(rect[`x`].(float64)), Y: int(rect["y"].(float64)), Width: int(rect["width"].(float64)), Height: int(rect["height"].(float64))})
-				}
-			}
+	walk_nodes(root, func(node *Node) {
+		if node.Pid > 0 && node.Visible {
+			regions = append(regions, common.WindowRegion{X: node.Rect.X, Y: node.Rect.Y, Width: node.Rect.Width, Height: node.Rect.Height, Label: node.Name})
 		}
-
 	})
 	return
 }
 
+// sway_quote returns s as a double quoted argument for sway commands, so that
+// workspace names containing spaces, ; or , are not split up
+func sway_quote(s string) string {
+	b := strings.Builder{}
+	b.Grow(len(s) + 2)
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// workspace_arg returns the argument for the workspace commands to refer to
+// the named workspace
+func workspace_arg(name string) string {
+	if name == common.WorkspaceBackAndForth {
+		return "back_and_forth"
+	}
+	return sway_quote(name)
+}
+
 func ChangeToWorkspace(name string) (err error) {
-	var conn *net.UnixConn
-	if conn, err = connect_to_sway(); err != nil {
+	_, err = RunCommands("workspace " + workspace_arg(name))
+	return
+}
+
+// focus_workspace_cmd focuses the workspace, ignoring the auto back and forth setting
+func focus_workspace_cmd(name string) string {
+	return "workspace --no-auto-back-and-forth " + sway_quote(name)
+}
+
+func BringWorkspaceHere(name string) (err error) {
+	return with_client(func(c *Client) (err error) {
+		var workspaces []Workspace
+		var outputs []Output
+		if workspaces, err = c.GetWorkspaces(); err != nil {
+			return
+		}
+		if outputs, err = c.GetOutputs(); err != nil {
+			return
+		}
+		var here, there *Output
+		for i, o := range outputs {
+			if o.Focused {
+				here = &outputs[i]
+			}
+		}
+		var target *Workspace
+		for i, ws := range workspaces {
+			if ws.Name == name {
+				target = &workspaces[i]
+			}
+		}
+		for i, o := range outputs {
+			if target != nil && o.Name == target.Output {
+				there = &outputs[i]
+			}
+		}
+		if here == nil || target == nil || there == nil || there.Name == here.Name {
+			_, err = c.RunCommands(focus_workspace_cmd(name))
+			return
+		}
+		// sway can only move the focused workspace, so focus it, move it
+		// here and then restore the workspace shown on its previous output
+		cmds := []string{focus_workspace_cmd(name), "move workspace to output " + here.Name}
+		if target.Visible {
+			// swap with the workspace shown here
+			cmds = append(cmds, focus_workspace_cmd(here.Current_workspace), "move workspace to output "+there.Name)
+		} else if there.Current_workspace != "" {
+			cmds = append(cmds, focus_workspace_cmd(there.Current_workspace))
+		}
+		cmds = append(cmds, focus_workspace_cmd(name))
+		_, err = c.RunCommands(cmds...)
 		return
+	})
+}
+
+func MoveWorkspaceToOutput(workspace, output string) (err error) {
+	return with_client(func(c *Client) (err error) {
+		var workspaces []Workspace
+		var outputs []Output
+		if workspaces, err = c.GetWorkspaces(); err != nil {
+			return
+		}
+		if outputs, err = c.GetOutputs(); err != nil {
+			return
+		}
+		var target, focused *Workspace
+		for i, ws := range workspaces {
+			if ws.Name == workspace {
+				target = &workspaces[i]
+			}
+			if ws.Focused {
+				focused = &workspaces[i]
+			}
+		}
+		if target == nil || target.Output == output {
+			return
+		}
+		move := "move workspace to output " + output
+		if target.Focused {
+			_, err = c.RunCommands(move)
+			return
+		}
+		// sway can only move the focused workspace, so focus it, move it and
+		// then restore the workspace shown on its previous output and the focus
+		cmds := []string{focus_workspace_cmd(workspace), move}
+		for _, o := range outputs {
+			if o.Name == target.Output && o.Current_workspace != "" && o.Current_workspace != workspace {
+				cmds = append(cmds, focus_workspace_cmd(o.Current_workspace))
+			}
+		}
+		if focused != nil {
+			cmds = append(cmds, focus_workspace_cmd(focused.Name))
+		}
+		_, err = c.RunCommands(cmds...)
+		return
+	})
+}
+
+// stack_container returns the stacked or tabbed container in the workspace
+// that windows should join, preferring the one on the focus path.
+func stack_container(ws *Node) *Node {
+	for n := ws; n != nil; n = n.FocusedChild() {
+		if n.IsStacked() {
+			return n
+		}
+	}
+	return ws.Find(func(n *Node) bool { return n.IsStacked() && n.Type != "floating_con" })
+}
+
+const move_target_mark = "_wm_move_target"
+
+// move_next_to puts the window next to the sibling so that it joins the
+// container of the sibling
+func move_next_to(c *Client, window, sibling *Node) (err error) {
+	target := fmt.Sprintf("[con_id=%d] ", sibling.Id)
+	_, err = c.RunCommands(target+"mark --add "+move_target_mark, fmt.Sprintf("[con_id=%d] move container to mark %s", window.Id, move_target_mark))
+	if _, uerr := c.RunCommands(target + "unmark " + move_target_mark); err == nil {
+		err = uerr
 	}
-	err = swaymsg(conn, RUN_COMMAND, []byte("workspace "+name))
 	return
 }
 
-func SwayBar(set_string func(change, val string)) (err error) {
-	var payload []byte
-	var msg_type uint32
-	var conn *net.UnixConn
-	if conn, err = connect_to_sway(); err != nil {
+// move the window managing the window stacks in the target workspace, see hypr.move_to_workspace
+func move_to_workspace(c *Client, active_window *Node, target_workspace *Node, name string) (err error) {
+	win := fmt.Sprintf("[con_id=%d] ", active_window.Id)
+	move := win + "move container to workspace " + workspace_arg(name)
+	if target_workspace == nil {
+		// workspace does not exist, just move unconditionally
+		_, err = c.RunCommands(move)
 		return
 	}
-	subscribe_to, _ := json.Marshal([]string{"workspace", "window"})
-	if err = swaymsg(conn, SUBSCRIBE, subscribe_to); err != nil {
-		return
+	var sibling *Node
+	if stack := stack_container(target_workspace); stack != nil {
+		sibling = stack.FocusedChild()
+	}
+	switch {
+	case sibling != nil:
+		err = move_next_to(c, active_window, sibling)
+	case len(target_workspace.Leaves()) == 0:
+		// single window in target workspace so put it in stack layout
+		_, err = c.RunCommands(move, win+"layout stacking")
+	default:
+		_, err = c.RunCommands(move)
 	}
-	var find_focused_window_title func(node map[string]any) string
-	find_focused_window_title = func(node map[string]any) string {
-		if f, ok := node[`focused`].(bool); ok && f {
-			if name, ok := node[`name`].(string); ok && name != "" {
-				return name
+	return
+}
+
+func MoveToWorkspace(name string) (err error) {
+	return with_client(func(c *Client) (err error) {
+		var root *Node
+		if root, err = c.GetTree(); err != nil {
+			return
+		}
+		active_window := root.FindFocused()
+		if active_window == nil || !active_window.IsView() {
+			return
+		}
+		if name == common.WorkspaceBackAndForth {
+			// the previous workspace is not known so its stacks cannot be managed
+			return move_to_workspace(c, active_window, nil, name)
+		}
+		var target_workspace *Node
+		for _, ws := range root.Workspaces() {
+			if ws.Name == name {
+				target_workspace = ws
+				break
 			}
 		}
-		for _, key := range []string{"nodes", "floating_nodes"} {
-			if fn, ok := node[key].([]any); ok {
-				for _, x := range fn {
-					if child, ok := x.(map[string]any); ok {
-						if name := find_focused_window_title(child); name != "" {
-							return name
-						}
-					}
-				}
+		if target_workspace != nil {
+			if active_workspace := root.WorkspaceOf(active_window.Id); active_workspace != nil && active_workspace.Id == target_workspace.Id {
+				return
 			}
+		}
+		return move_to_workspace(c, active_window, target_workspace, name)
+	})
+}
 
+// ToggleStack switches the container of the focused window between the
+// stacked layout and the split layout it had before, which sway remembers
+func ToggleStack() (err error) {
+	return with_client(func(c *Client) (err error) {
+		var root *Node
+		if root, err = c.GetTree(); err != nil {
+			return
 		}
-		return ""
-	}
+		focused := root.FindFocused()
+		if focused == nil || !focused.IsView() {
+			return
+		}
+		// the layout command applies to the container of the window
+		_, err = c.RunCommands(fmt.Sprintf("[con_id=%d] layout toggle split stacking", focused.Id))
+		return
+	})
+}
 
-	handle_response := func() {
-		var x map[string]any
-		var nodes []map[string]any
-		switch msg_type {
-		case SUBSCRIBE:
-			if string(payload) != `{"success": true}` {
-				debugprintln(fmt.Errorf("Subscribe to sway events failed with unexpected payload: %#v", string(payload)))
-				return
-			}
-		case GET_WORKSPACES:
-			if err = json.Unmarshal(payload, &nodes); err != nil {
-				debugprintln(fmt.Errorf("Workspace query failed with unexpected payload: %#v", string(payload)))
+func ApplyWindowActions(id string, actions common.WindowActions) (err error) {
+	con_id, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("Invalid sway window id: %#v", id)
+	}
+	return with_client(func(c *Client) (err error) {
+		var root *Node
+		if root, err = c.GetTree(); err != nil {
+			return
+		}
+		window := root.Find(func(n *Node) bool { return n.Id == con_id })
+		if window == nil {
+			return fmt.Errorf("No window with id: %d", con_id)
+		}
+		win := fmt.Sprintf("[con_id=%d] ", con_id)
+		cmds := []string{}
+		floating := window.Type == "floating_con"
+		if actions.Floating != nil {
+			floating = *actions.Floating
+			cmds = append(cmds, win+"floating "+utils.IfElse(floating, "enable", "disable"))
+		}
+		if actions.Width > 0 && actions.Height > 0 {
+			cmds = append(cmds, fmt.Sprintf("%sresize set width %d px height %d px", win, actions.Width, actions.Height))
+		}
+		if actions.Fullscreen {
+			cmds = append(cmds, win+"fullscreen enable")
+		}
+		if len(cmds) > 0 {
+			if _, err = c.RunCommands(cmds...); err != nil {
 				return
 			}
-			for _, x := range nodes {
-				if f, ok := x[`focused`].(bool); ok && f {
-					if f, ok := x[`visible`].(bool); ok && f {
-						if name, ok := x[`name`].(string); ok {
-							_, n, _ := strings.Cut(name, ":")
-							set_string("workspace", n)
-						}
-					}
+		}
+		ws := root.WorkspaceOf(con_id)
+		if actions.Workspace != "" && (ws == nil || ws.Name != actions.Workspace) {
+			var target_workspace *Node
+			for _, x := range root.Workspaces() {
+				if x.Name == actions.Workspace {
+					target_workspace = x
 				}
 			}
-		case GET_TREE:
-			if err = json.Unmarshal(payload, &x); err != nil {
-				debugprintln(fmt.Errorf("get_tree query failed with unexpected payload: %#v", string(payload)))
-				return
-			}
-			set_string("title", find_focused_window_title(x))
-		case EVENT_WORKSPACE:
-			if err = json.Unmarshal(payload, &x); err != nil {
-				debugprintln("Failed to parse message of type %x from sway with error: %s", msg_type, err)
-				return
-			}
-			if change, ok := x[`change`].(string); ok && change == `focus` {
-				if c, ok := x[`current`].(map[string]any); ok {
-					if name, ok := c[`name`].(string); ok {
-						_, n, _ := strings.Cut(name, ":")
-						set_string("workspace", n)
-					}
-				}
+			if floating {
+				target_workspace = nil
 			}
-		case EVENT_WINDOW:
-			if err = json.Unmarshal(payload, &x); err != nil {
-				debugprintln("Failed to parse message of type %x from sway with error: %s", msg_type, err)
+			return move_to_workspace(c, window, target_workspace, actions.Workspace)
+		}
+		if actions.Stack && !floating && ws != nil {
+			if parent := root.ParentOf(con_id); parent != nil && parent.IsStacked() {
 				return
 			}
-			if change, ok := x[`change`].(string); ok {
-				switch change {
-				case `focus`:
-					if container, ok := x[`container`].(map[string]any); ok {
-						if name, ok := container[`name`].(string); ok {
-							set_string("title", name)
-						}
-					}
-				case `title`:
-					if container, ok := x[`container`].(map[string]any); ok {
-						if focused, ok := container[`focused`].(bool); ok && focused {
-							if name, ok := container[`name`].(string); ok {
-								set_string("title", name)
-							}
-						}
-					}
+			if stack := stack_container(ws); stack != nil {
+				if sibling := stack.FocusedChild(); sibling != nil {
+					return move_next_to(c, window, sibling)
 				}
+			} else if len(ws.Leaves()) == 1 {
+				_, err = c.RunCommands(win + "layout stacking")
 			}
-		default:
-			debugprintln("Got unknown message type from sway: %x", msg_type)
 		}
-	}
-	if err = swaymsg(conn, GET_WORKSPACES, nil); err != nil {
-		return
-	}
-	if err = swaymsg(conn, GET_TREE, nil); err != nil {
 		return
-	}
-	go func() {
-		var err error
-		for {
-			if msg_type, payload, err = read_one_msg(conn); err != nil {
-				debugprintln("Failed to read message from sway with error: %s", err)
-				return
+	})
+}
+
+func SuperTab() (err error) {
+	return with_client(func(c *Client) (err error) {
+		var root *Node
+		if root, err = c.GetTree(); err != nil {
+			return
+		}
+		cmd := "focus next"
+		if focused := root.FindFocused(); focused != nil {
+			if parent := root.ParentOf(focused.Id); parent != nil && parent.IsStacked() && len(parent.Nodes) > 1 {
+				cmd = "focus next sibling"
 			}
-			handle_response()
 		}
-	}()
-	return
-} // }}}
+		_, err = c.RunCommands(cmd)
+		return
+	})
+}
@@ -0,0 +1,586 @@
+package sway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+	"wm/common"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var _ = fmt.Print
+
+func TestGetTree(t *testing.T) {
+	new_fake_sway(t)
+	root, err := get_tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root.Type != "root" || len(root.Nodes) != 2 {
+		t.Fatalf("Unexpected root node: %s", root)
+	}
+	f := root.FindFocused()
+	if f == nil || f.Id != 10 {
+		t.Fatalf("Failed to find focused node, got: %v", f)
+	}
+	ids := func(nodes []*Node) (ans []int) {
+		for _, n := range nodes {
+			ans = append(ans, n.Id)
+		}
+		return
+	}
+	if diff := cmp.Diff([]int{10, 11, 12, 22, 23}, ids(root.Leaves())); diff != "" {
+		t.Fatalf("Unexpected leaves:\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{11}, ids(root.ByAppID("firefox"))); diff != "" {
+		t.Fatalf("Unexpected ByAppID result:\n%s", diff)
+	}
+	if diff := cmp.Diff([]int{10, 23}, ids(root.ByAppID("kitty"))); diff != "" {
+		t.Fatalf("Unexpected ByAppID result:\n%s", diff)
+	}
+	if ws := root.WorkspaceOf(23); ws == nil || ws.Name != "2" {
+		t.Fatalf("Unexpected workspace for node 23: %v", ws)
+	}
+	if p := root.ParentOf(12); p == nil || p.Id != 5 {
+		t.Fatalf("Unexpected parent for floating node: %v", p)
+	}
+}
+
+func TestWalkNodes(t *testing.T) {
+	new_fake_sway(t)
+	root, err := get_tree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []int
+	walk_nodes(root, func(n *Node) { seen = append(seen, n.Id) })
+	if diff := cmp.Diff([]int{1, 2, 3, 4, 5, 10, 11, 12, 20, 21, 22, 23}, seen); diff != "" {
+		t.Fatalf("walk_nodes visited unexpected nodes:\n%s", diff)
+	}
+}
+
+func TestGetWindowRegions(t *testing.T) {
+	new_fake_sway(t)
+	regions, err := GetWindowRegions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []common.WindowRegion{
+		{X: 0, Y: 0, Width: 960, Height: 1080, Label: "kitty"},
+		{X: 960, Y: 0, Width: 960, Height: 1080, Label: "Mozilla Firefox"},
+		{X: 100, Y: 100, Width: 300, Height: 400, Label: "calculator"},
+	}
+	if diff := cmp.Diff(expected, regions); diff != "" {
+		t.Fatalf("Unexpected window regions:\n%s", diff)
+	}
+	// a node with a missing rect must not cause a panic
+	s := new_fake_sway(t)
+	s.set_reply(GET_TREE, map[string]any{"id": 1, "type": "root", "nodes": []any{map[string]any{"id": 2, "type": "con", "pid": 3, "visible": true}}})
+	if regions, err = GetWindowRegions(); err != nil || len(regions) != 1 {
+		t.Fatalf("Unexpected result for tree with missing rect: %v %v", regions, err)
+	}
+}
+
+func TestGetPIDsForGracefulShutdown(t *testing.T) {
+	new_fake_sway(t)
+	// Only tiled windows with an app_id are included
+	if diff := cmp.Diff([]int{100, 200, 201}, GetPIDsForGracefulShutdown()); diff != "" {
+		t.Fatalf("Unexpected pids:\n%s", diff)
+	}
+}
+
+func TestTogglePower(t *testing.T) {
+	s := new_fake_sway(t)
+	if err := TogglePower("off", "HDMI*"); err != nil {
+		t.Fatal(err)
+	}
+	if err := TogglePower("toggle", "*"); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{"output HDMI-A-1 power off", "output eDP-1 power toggle", "output HDMI-A-1 power toggle"}
+	if diff := cmp.Diff(expected, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+	if err := TogglePower("off", "["); err == nil {
+		t.Fatalf("No error for invalid glob")
+	}
+}
+
+func TestExitSway(t *testing.T) {
+	s := new_fake_sway(t)
+	if err := ExitSway(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"exit"}, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+	s.failing_commands["exit"] = "not allowed"
+	err := ExitSway()
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Fatalf("Unexpected error for failing exit: %v", err)
+	}
+}
+
+func TestChangeToWorkspace(t *testing.T) {
+	s := new_fake_sway(t)
+	if err := ChangeToWorkspace("3"); err != nil {
+		t.Fatal(err)
+	}
+	s.failing_commands[`workspace "bad"`] = "Invalid workspace"
+	if err := ChangeToWorkspace(common.WorkspaceBackAndForth); err != nil {
+		t.Fatal(err)
+	}
+	err := ChangeToWorkspace("bad")
+	var cerr *CommandError
+	if !errors.As(err, &cerr) || cerr.Command != `workspace "bad"` || cerr.Message != "Invalid workspace" {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	if err := ChangeToWorkspace(`2: web; "x"`); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{`workspace "3"`, "workspace back_and_forth", `workspace "bad"`, `workspace "2: web; \"x\""`}
+	if diff := cmp.Diff(expected, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+}
+
+func TestSwayQuote(t *testing.T) {
+	for q, expected := range map[string]string{
+		"2: web": `"2: web"`, `a"b\c`: `"a\"b\\c"`, "": `""`,
+	} {
+		if actual := sway_quote(q); actual != expected {
+			t.Fatalf("sway_quote(%#v) = %s != %s", q, actual, expected)
+		}
+	}
+}
+
+func TestRunCommands(t *testing.T) {
+	s := new_fake_sway(t)
+	s.failing_commands["b"] = "oops"
+	results, err := RunCommands("a", "b", "c")
+	if err == nil || err.Error() != "The sway command: b failed with error: oops" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// failures do not stop the batch
+	expected := []CommandResult{{Command: "a", Success: true}, {Command: "b", Error: "oops"}, {Command: "c", Success: true}}
+	if diff := cmp.Diff(expected, results); diff != "" {
+		t.Fatalf("Unexpected results:\n%s", diff)
+	}
+
+	// there is a result for every ,-separated sub-command so the whole batch is reported
+	results, err = RunCommands("a, b", "c")
+	if err == nil || err.Error() != "The sway command: a, b; c failed with error: oops" {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(results) != 3 || results[0].Command != "a, b; c" {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+
+	// parse errors abort the batch, the failing command is still named exactly
+	s.invalid_commands["x"] = "Unknown command"
+	results, err = RunCommands("a", "x", "c")
+	var cerr *CommandError
+	if !errors.As(err, &cerr) || !cerr.Parse_error || cerr.Command != "x" {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	expected = []CommandResult{{Command: "a", Success: true}, {Command: "x", Error: "Unknown command", Parse_error: true}}
+	if diff := cmp.Diff(expected, results); diff != "" {
+		t.Fatalf("Unexpected results:\n%s", diff)
+	}
+	// but not when there are sub-commands, quoted commas do not count
+	results, err = RunCommands(`mark "a,b"`, "a, c", "x", "c")
+	if !errors.As(err, &cerr) || !cerr.Parse_error || cerr.Command != `mark "a,b"; a, c; x; c` {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+	if len(results) != 4 {
+		t.Fatalf("Unexpected results: %v", results)
+	}
+	results, err = RunCommands(`mark "a,b"`, "x")
+	if !errors.As(err, &cerr) || cerr.Command != "x" || results[0].Command != `mark "a,b"` {
+		t.Fatalf("Unexpected error: %#v", err)
+	}
+}
+
+func TestMoveToWorkspace(t *testing.T) {
+	s := new_fake_sway(t)
+	// target is stacked so the window is placed next to the focused window in the stack
+	if err := MoveToWorkspace("2"); err != nil {
+		t.Fatal(err)
+	}
+	// target does not exist
+	if err := MoveToWorkspace("7"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveToWorkspace("2: web"); err != nil {
+		t.Fatal(err)
+	}
+	// target is the current workspace
+	if err := MoveToWorkspace("1:web"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveToWorkspace(common.WorkspaceBackAndForth); err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"[con_id=23] mark --add _wm_move_target", "[con_id=10] move container to mark _wm_move_target", "[con_id=23] unmark _wm_move_target",
+		`[con_id=10] move container to workspace "7"`, `[con_id=10] move container to workspace "2: web"`,
+		"[con_id=10] move container to workspace back_and_forth",
+	}
+	if diff := cmp.Diff(expected, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+}
+
+func TestToggleStack(t *testing.T) {
+	s := new_fake_sway(t)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	// nothing to do without a focused window
+	root, _ := get_tree()
+	root.Walk(func(n *Node) { n.Focused = n.Id == 20 })
+	s.set_reply(GET_TREE, root)
+	if err := ToggleStack(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"[con_id=10] layout toggle split stacking"}, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+}
+
+func TestSuperTab(t *testing.T) {
+	s := new_fake_sway(t)
+	root, _ := get_tree()
+	// not in a stack
+	if err := SuperTab(); err != nil {
+		t.Fatal(err)
+	}
+	root.Walk(func(n *Node) { n.Focused = n.Id == 23 })
+	s.set_reply(GET_TREE, root)
+	if err := SuperTab(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"focus next", "focus next sibling"}, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+}
+
+func next_event(t *testing.T, events <-chan common.Event) common.Event {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatalf("Event stream closed unexpectedly")
+		}
+		return ev
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for event")
+	}
+	return nil
+}
+
+func TestSubscribe(t *testing.T) {
+	s := new_fake_sway(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events, err := Subscribe(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := func(expected common.Event) {
+		t.Helper()
+		if diff := cmp.Diff(expected, next_event(t, events)); diff != "" {
+			t.Fatalf("Unexpected event:\n%s", diff)
+		}
+	}
+	expect(common.WorkspaceFocused{Name: "1:web", Output: "eDP-1"})
+	expect(common.WindowFocused{Id: "10", Class: "kitty", Title: "kitty"})
+
+	s.emit("workspace", EVENT_WORKSPACE, map[string]any{"change": "focus", "current": map[string]any{"id": 20, "name": "2", "output": "eDP-1"}})
+	expect(common.WorkspaceFocused{Name: "2", Output: "eDP-1"})
+	s.emit("window", EVENT_WINDOW, map[string]any{"change": "title", "container": map[string]any{"id": 23, "name": "vim"}})
+	expect(common.TitleChanged{Id: "23", Title: "vim"})
+	s.emit("window", EVENT_WINDOW, map[string]any{"change": "focus", "container": map[string]any{"id": 11, "name": "Firefox", "window_properties": map[string]any{"class": "firefox"}}})
+	expect(common.WindowFocused{Id: "11", Class: "firefox", Title: "Firefox"})
+	s.emit("mode", EVENT_MODE, map[string]any{"change": "resize"})
+	expect(common.ModeChanged{Mode: "resize"})
+	s.set_reply(GET_OUTPUTS, []map[string]any{{"name": "eDP-1"}, {"name": "DP-2"}})
+	s.emit("output", EVENT_OUTPUT, map[string]any{"change": "unspecified"})
+	expect(common.MonitorAdded{Name: "DP-2"})
+	expect(common.MonitorRemoved{Name: "HDMI-A-1"})
+
+	// simulate a sway reload, the stream must reconnect and resync
+	s.disconnect_all()
+	ev := next_event(t, events)
+	if cs, ok := ev.(common.ConnectionState); !ok || cs.Connected {
+		t.Fatalf("Unexpected event after disconnect: %#v", ev)
+	}
+	expect(common.ConnectionState{Connected: true})
+	expect(common.WorkspaceFocused{Name: "1:web", Output: "eDP-1"})
+	expect(common.WindowFocused{Id: "10", Class: "kitty", Title: "kitty"})
+
+	cancel()
+	for range events {
+	}
+}
+
+func TestTraceAndReplay(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	trace_path := filepath.Join(t.TempDir(), "trace.jsonl")
+	exercise := func(emit func()) (received []common.Event) {
+		t.Helper()
+		if err := ToggleStack(); err != nil {
+			t.Fatal(err)
+		}
+		if err := SuperTab(); err != nil {
+			t.Fatal(err)
+		}
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		events, err := Subscribe(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		emit()
+		for range 3 {
+			received = append(received, next_event(t, events))
+		}
+		return
+	}
+
+	s := new_fake_sway(t)
+	if err := common.EnableIPCTrace(trace_path); err != nil {
+		t.Fatal(err)
+	}
+	recorded := exercise(func() {
+		// wait for the subscription so the event is not lost
+		for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(5 * time.Millisecond) {
+			s.lock.Lock()
+			subscribed := slices.ContainsFunc(s.conns, func(c *fake_conn) bool { return c.subscribed.Has("workspace") })
+			s.lock.Unlock()
+			if subscribed {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("Timed out waiting for subscription")
+			}
+		}
+		s.emit("workspace", EVENT_WORKSPACE, map[string]any{"change": "focus", "current": map[string]any{"id": 20, "name": "2", "output": "eDP-1"}})
+	})
+	common.DisableIPCTrace()
+	records, err := common.ReadIPCTrace(trace_path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchanges, events := common.PairIPCTrace(records)
+	if len(exchanges) == 0 || len(events) != 1 || *events[0].Type != EVENT_WORKSPACE {
+		t.Fatalf("Unexpected trace, exchanges: %d events: %v", len(exchanges), events)
+	}
+	for _, x := range exchanges {
+		if x.Response == nil || x.Request.Direction != "send" || x.Response.Direction != "recv" || x.Request.Time.IsZero() {
+			t.Fatalf("Invalid exchange in trace: %#v", x)
+		}
+	}
+
+	r := new_replay_sway(t, trace_path)
+	replayed := exercise(func() {})
+	if diff := cmp.Diff(recorded, replayed); diff != "" {
+		t.Fatalf("Replayed events differ:\n%s", diff)
+	}
+	if n := r.unreplayed(); n != 0 {
+		t.Fatalf("%d recorded exchanges were not replayed", n)
+	}
+}
+
+func TestGetState(t *testing.T) {
+	fs := new_fake_sway(t)
+	s, err := GetState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := s.ActiveWindow()
+	if w == nil {
+		t.Fatal("No active window")
+	}
+	expected := common.Window{Id: "10", Class: "kitty", Title: "kitty", Initial_class: "kitty", Initial_title: "kitty", Pid: 100, Workspace: "1:web", Output: "eDP-1", Width: 960, Height: 1080, Focused: true}
+	if diff := cmp.Diff(expected, *w); diff != "" {
+		t.Fatalf("Unexpected active window:\n%s", diff)
+	}
+	ids := func() (ans []string) {
+		for _, w := range s.Windows {
+			ans = append(ans, w.Id)
+		}
+		return
+	}
+	if diff := cmp.Diff([]string{"10", "11", "12", "22", "23"}, ids()); diff != "" {
+		t.Fatalf("Unexpected windows:\n%s", diff)
+	}
+	if !s.Windows[2].Floating || s.Windows[1].Class != "firefox" {
+		t.Fatalf("Unexpected window properties: %v", s.Windows[1:3])
+	}
+	order := map[string]int{}
+	for _, w := range s.Windows {
+		order[w.Id] = w.Focus_order
+	}
+	if diff := cmp.Diff(map[string]int{"10": 0, "12": 1, "11": 2, "23": 3, "22": 4}, order); diff != "" {
+		t.Fatalf("Unexpected focus order:\n%s", diff)
+	}
+	if diff := cmp.Diff([]string{"22", "23"}, s.Windows[3].Stack); diff != "" {
+		t.Fatalf("Unexpected stack:\n%s", diff)
+	}
+	if diff := cmp.Diff(common.Workspace{Id: 20, Name: "2", Output: "eDP-1", Windows: 2}, s.Workspaces[1]); diff != "" {
+		t.Fatalf("Unexpected workspace:\n%s", diff)
+	}
+	if ws := s.ActiveWorkspace(); ws == nil || ws.Name != "1:web" || !ws.Visible || ws.Windows != 3 {
+		t.Fatalf("Unexpected active workspace: %v", ws)
+	}
+	if len(s.Outputs) != 2 || s.Outputs[1].Description != "Dell U2720Q ABC" || !s.Outputs[0].Focused {
+		t.Fatalf("Unexpected outputs: %v", s.Outputs)
+	}
+
+	// windows in the scratchpad are hidden and not on any workspace
+	root, _ := get_tree()
+	scratch := root.Find(func(n *Node) bool { return n.Name == scratch_workspace_name })
+	scratch.Floating_nodes = append(scratch.Floating_nodes, &Node{Id: 30, Name: "dropdown", Type: "floating_con", App_id: "foot", Pid: 300})
+	fs.set_reply(GET_TREE, root)
+	if s, err = GetState(); err != nil {
+		t.Fatal(err)
+	}
+	i := slices.IndexFunc(s.Windows, func(w common.Window) bool { return w.Id == "30" })
+	if i < 0 {
+		t.Fatalf("Scratchpad window not reported: %v", s.Windows)
+	}
+	if w = &s.Windows[i]; !w.Hidden || w.Workspace != "" || w.Output != "" {
+		t.Fatalf("Unexpected scratchpad window: %v", w)
+	}
+	if slices.ContainsFunc(s.Workspaces, func(ws common.Workspace) bool { return ws.Name == scratch_workspace_name }) {
+		t.Fatalf("Scratchpad workspace reported: %v", s.Workspaces)
+	}
+}
+
+func TestFocusWindow(t *testing.T) {
+	s := new_fake_sway(t)
+	if err := FocusWindow("23"); err != nil {
+		t.Fatal(err)
+	}
+	if err := FocusWindow("x"); err == nil {
+		t.Fatal("No error for invalid window id")
+	}
+	if diff := cmp.Diff([]string{"[con_id=23] focus"}, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+}
+
+func TestToggleScratchpad(t *testing.T) {
+	scratch := `{"id": 3, "name": "__i3_scratch", "type": "workspace", "layout": "splith", "nodes": [], "floating_nodes": []}`
+	with_hidden := strings.Replace(test_tree, scratch, `{"id": 3, "name": "__i3_scratch", "type": "workspace", "layout": "splith", "nodes": [],
+	"floating_nodes": [{"id": 30, "name": "dropdown", "type": "floating_con", "app_id": "foot", "pid": 300, "marks": ["_wm_scratchpad_term"], "nodes": [], "floating_nodes": []}]}`, 1)
+	shown := strings.Replace(test_tree, `"app_id": "calc", "pid": 102,`, `"app_id": "calc", "pid": 102, "marks": ["_wm_scratchpad_term"],`, 1)
+	if with_hidden == test_tree || shown == test_tree {
+		t.Fatal("Failed to add scratchpad window to the test tree")
+	}
+	for _, tc := range []struct {
+		tree, id string
+		expected []string
+	}{
+		{test_tree, "11", []string{`[con_id=11] mark --add "_wm_scratchpad_term"`, "[con_id=11] move scratchpad", "[con_id=11] scratchpad show"}},
+		// a floating window on the focused workspace that is not in the scratchpad
+		{test_tree, "12", []string{`[con_id=12] mark --add "_wm_scratchpad_term"`, "[con_id=12] move scratchpad", "[con_id=12] scratchpad show"}},
+		{with_hidden, "30", []string{"[con_id=30] scratchpad show"}},
+		{shown, "12", []string{"[con_id=12] move scratchpad"}},
+	} {
+		s := new_fake_sway(t)
+		s.set_reply(GET_TREE, json.RawMessage(tc.tree))
+		if err := ToggleScratchpad("term", tc.id); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(tc.expected, s.received_commands()); diff != "" {
+			t.Fatalf("Unexpected commands for window %s:\n%s", tc.id, diff)
+		}
+	}
+	new_fake_sway(t)
+	if err := ToggleScratchpad("term", "99"); err == nil {
+		t.Fatal("No error for non-existent window")
+	}
+}
+
+func TestBringWorkspaceHere(t *testing.T) {
+	s := new_fake_sway(t)
+	s.set_reply(GET_WORKSPACES, json.RawMessage(`[
+  {"id": 5, "num": 1, "name": "1:web", "visible": true, "focused": true, "output": "eDP-1"},
+  {"id": 20, "num": 2, "name": "2", "visible": false, "focused": false, "output": "eDP-1"},
+  {"id": 30, "num": 3, "name": "3", "visible": true, "focused": false, "output": "HDMI-A-1"},
+  {"id": 40, "num": 4, "name": "4", "visible": false, "focused": false, "output": "HDMI-A-1"}
+]`))
+	for _, name := range []string{"2", "3", "4", "7"} {
+		if err := BringWorkspaceHere(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := MoveWorkspaceToOutput("4", "eDP-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveWorkspaceToOutput("1:web", "HDMI-A-1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveWorkspaceToOutput("2", "eDP-1"); err != nil {
+		t.Fatal(err)
+	}
+	ws := func(name string) string { return `workspace --no-auto-back-and-forth "` + name + `"` }
+	expected := []string{
+		// on this output already
+		ws("2"),
+		// visible on the other output so swapped
+		ws("3"), "move workspace to output eDP-1", ws("1:web"), "move workspace to output HDMI-A-1", ws("3"),
+		// hidden on the other output
+		ws("4"), "move workspace to output eDP-1", ws("3"), ws("4"),
+		// does not exist
+		ws("7"),
+		// move a workspace that is not focused
+		ws("4"), "move workspace to output eDP-1", ws("3"), ws("1:web"),
+		// move the focused workspace
+		"move workspace to output HDMI-A-1",
+	}
+	if diff := cmp.Diff(expected, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+}
+
+func TestApplyWindowActions(t *testing.T) {
+	s := new_fake_sway(t)
+	floating := true
+	// join the stack on another workspace
+	if err := ApplyWindowActions("11", common.WindowActions{Workspace: "2", Width: 800, Height: 600}); err != nil {
+		t.Fatal(err)
+	}
+	// floating windows are just moved
+	if err := ApplyWindowActions("10", common.WindowActions{Workspace: "2", Floating: &floating, Fullscreen: true}); err != nil {
+		t.Fatal(err)
+	}
+	// stack in place, joining the existing stack
+	if err := ApplyWindowActions("11", common.WindowActions{Stack: true}); err != nil {
+		t.Fatal(err)
+	}
+	// already in the stack
+	if err := ApplyWindowActions("22", common.WindowActions{Stack: true}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyWindowActions("99", common.WindowActions{Stack: true}); err == nil {
+		t.Fatal("No error for non-existent window")
+	}
+	expected := []string{
+		"[con_id=11] resize set width 800 px height 600 px",
+		"[con_id=23] mark --add _wm_move_target", "[con_id=11] move container to mark _wm_move_target", "[con_id=23] unmark _wm_move_target",
+		"[con_id=10] floating enable", "[con_id=10] fullscreen enable", `[con_id=10] move container to workspace "2"`,
+	}
+	if diff := cmp.Diff(expected, s.received_commands()); diff != "" {
+		t.Fatalf("Unexpected commands:\n%s", diff)
+	}
+}
@@ -0,0 +1,354 @@
+package sway
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+var _ = fmt.Print
+
+// IPC data types, see man 7 sway-ipc {{{
+type Rect struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Width  int `json:"width"`
+	Height int `json:"height"`
+}
+
+type WindowProperties struct {
+	Title         string `json:"title"`
+	Class         string `json:"class"`
+	Instance      string `json:"instance"`
+	Window_role   string `json:"window_role"`
+	Window_type   string `json:"window_type"`
+	Transient_for int    `json:"transient_for"`
+}
+
+type Node struct {
+	Id                   int               `json:"id"`
+	Name                 string            `json:"name"`
+	Type                 string            `json:"type"`
+	Border               string            `json:"border"`
+	Current_border_width int               `json:"current_border_width"`
+	Layout               string            `json:"layout"`
+	Orientation          string            `json:"orientation"`
+	Percent              float64           `json:"percent"`
+	Rect                 Rect              `json:"rect"`
+	Window_rect          Rect              `json:"window_rect"`
+	Deco_rect            Rect              `json:"deco_rect"`
+	Geometry             Rect              `json:"geometry"`
+	Urgent               bool              `json:"urgent"`
+	Sticky               bool              `json:"sticky"`
+	Marks                []string          `json:"marks"`
+	Focused              bool              `json:"focused"`
+	Focus                []int             `json:"focus"`
+	Nodes                []*Node           `json:"nodes"`
+	Floating_nodes       []*Node           `json:"floating_nodes"`
+	Fullscreen_mode      int               `json:"fullscreen_mode"`
+	Representation       string            `json:"representation"`
+	Num                  int               `json:"num"`
+	Output               string            `json:"output"`
+	App_id               string            `json:"app_id"`
+	Pid                  int               `json:"pid"`
+	Visible              bool              `json:"visible"`
+	Shell                string            `json:"shell"`
+	Inhibit_idle         bool              `json:"inhibit_idle"`
+	Window               int               `json:"window"`
+	Window_properties    *WindowProperties `json:"window_properties"`
+}
+
+func (c Node) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type Workspace struct {
+	Id      int    `json:"id"`
+	Num     int    `json:"num"`
+	Name    string `json:"name"`
+	Layout  string `json:"layout"`
+	Visible bool   `json:"visible"`
+	Focused bool   `json:"focused"`
+	Urgent  bool   `json:"urgent"`
+	Output  string `json:"output"`
+	Rect    Rect   `json:"rect"`
+	Focus   []int  `json:"focus"`
+}
+
+func (c Workspace) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type OutputMode struct {
+	Width   int `json:"width"`
+	Height  int `json:"height"`
+	Refresh int `json:"refresh"`
+}
+
+type Output struct {
+	Id                   int          `json:"id"`
+	Name                 string       `json:"name"`
+	Make                 string       `json:"make"`
+	Model                string       `json:"model"`
+	Serial               string       `json:"serial"`
+	Active               bool         `json:"active"`
+	Dpms                 bool         `json:"dpms"`
+	Power                bool         `json:"power"`
+	Primary              bool         `json:"primary"`
+	Focused              bool         `json:"focused"`
+	Non_desktop          bool         `json:"non_desktop"`
+	Scale                float64      `json:"scale"`
+	Subpixel_hinting     string       `json:"subpixel_hinting"`
+	Transform            string       `json:"transform"`
+	Current_workspace    string       `json:"current_workspace"`
+	Modes                []OutputMode `json:"modes"`
+	Current_mode         OutputMode   `json:"current_mode"`
+	Rect                 Rect         `json:"rect"`
+	Adaptive_sync_status string       `json:"adaptive_sync_status"`
+}
+
+func (c Output) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type Input struct {
+	Identifier              string         `json:"identifier"`
+	Name                    string         `json:"name"`
+	Vendor                  int            `json:"vendor"`
+	Product                 int            `json:"product"`
+	Type                    string         `json:"type"`
+	Xkb_active_layout_name  string         `json:"xkb_active_layout_name"`
+	Xkb_layout_names        []string       `json:"xkb_layout_names"`
+	Xkb_active_layout_index int            `json:"xkb_active_layout_index"`
+	Scroll_factor           float64        `json:"scroll_factor"`
+	Libinput                map[string]any `json:"libinput"`
+}
+
+func (c Input) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type Seat struct {
+	Name         string  `json:"name"`
+	Capabilities int     `json:"capabilities"`
+	Focus        int     `json:"focus"`
+	Devices      []Input `json:"devices"`
+}
+
+func (c Seat) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type BarConfig struct {
+	Id                     string            `json:"id"`
+	Mode                   string            `json:"mode"`
+	Position               string            `json:"position"`
+	Status_command         string            `json:"status_command"`
+	Font                   string            `json:"font"`
+	Workspace_buttons      bool              `json:"workspace_buttons"`
+	Workspace_min_width    int               `json:"workspace_min_width"`
+	Binding_mode_indicator bool              `json:"binding_mode_indicator"`
+	Verbose                bool              `json:"verbose"`
+	Colors                 map[string]string `json:"colors"`
+	Gaps                   struct {
+		Top    int `json:"top"`
+		Right  int `json:"right"`
+		Bottom int `json:"bottom"`
+		Left   int `json:"left"`
+	} `json:"gaps"`
+	Bar_height          int `json:"bar_height"`
+	Status_padding      int `json:"status_padding"`
+	Status_edge_padding int `json:"status_edge_padding"`
+}
+
+func (c BarConfig) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type Version struct {
+	Major                   int    `json:"major"`
+	Minor                   int    `json:"minor"`
+	Patch                   int    `json:"patch"`
+	Human_readable          string `json:"human_readable"`
+	Loaded_config_file_name string `json:"loaded_config_file_name"`
+}
+
+func (c Version) String() string {
+	s, _ := json.MarshalIndent(&c, "", "  ")
+	return string(s)
+}
+
+type WorkspaceEvent struct {
+	Change  string `json:"change"`
+	Current *Node  `json:"current"`
+	Old     *Node  `json:"old"`
+}
+
+type WindowEvent struct {
+	Change    string `json:"change"`
+	Container *Node  `json:"container"`
+}
+
+// }}}
+
+// Tree walking {{{
+func walk_nodes(node *Node, callback func(*Node)) {
+	callback(node)
+	for _, collection := range [][]*Node{node.Nodes, node.Floating_nodes} {
+		for _, child := range collection {
+			walk_nodes(child, callback)
+		}
+	}
+}
+
+// Walk calls callback for this node and all its descendants, depth first,
+// tiled children before floating ones.
+func (self *Node) Walk(callback func(*Node)) {
+	walk_nodes(self, callback)
+}
+
+// FindFocused returns the focused node in the tree rooted at this node or nil.
+func (self *Node) FindFocused() (ans *Node) {
+	if self.Focused {
+		return self
+	}
+	for _, collection := range [][]*Node{self.Nodes, self.Floating_nodes} {
+		for _, child := range collection {
+			if ans = child.FindFocused(); ans != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// IsView returns true if this node is an actual application window.
+func (self *Node) IsView() bool {
+	return (self.Type == "con" || self.Type == "floating_con") && len(self.Nodes) == 0 && len(self.Floating_nodes) == 0
+}
+
+// Leaves returns all the application windows in the tree rooted at this node.
+func (self *Node) Leaves() (ans []*Node) {
+	walk_nodes(self, func(n *Node) {
+		if n.IsView() {
+			ans = append(ans, n)
+		}
+	})
+	return
+}
+
+// ByAppID returns all application windows with the specified app_id. For
+// XWayland windows the X11 class is matched instead.
+func (self *Node) ByAppID(app_id string) (ans []*Node) {
+	for _, n := range self.Leaves() {
+		if n.App_id == app_id || (n.App_id == "" && n.Window_properties != nil && n.Window_properties.Class == app_id) {
+			ans = append(ans, n)
+		}
+	}
+	return
+}
+
+// Find returns the first node in the tree rooted at this node for which
+// predicate is true, or nil.
+func (self *Node) Find(predicate func(*Node) bool) (ans *Node) {
+	if predicate(self) {
+		return self
+	}
+	for _, collection := range [][]*Node{self.Nodes, self.Floating_nodes} {
+		for _, child := range collection {
+			if ans = child.Find(predicate); ans != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// ParentOf returns the node whose tiled or floating children include the node
+// with the specified id, or nil.
+func (self *Node) ParentOf(id int) *Node {
+	return self.Find(func(n *Node) bool {
+		for _, collection := range [][]*Node{n.Nodes, n.Floating_nodes} {
+			for _, c := range collection {
+				if c.Id == id {
+					return true
+				}
+			}
+		}
+		return false
+	})
+}
+
+// FocusedChild returns the most recently focused tiled child of this node or
+// nil if it has no tiled children.
+func (self *Node) FocusedChild() *Node {
+	for _, id := range self.Focus {
+		for _, c := range self.Nodes {
+			if c.Id == id {
+				return c
+			}
+		}
+	}
+	if len(self.Nodes) > 0 {
+		return self.Nodes[0]
+	}
+	return nil
+}
+
+func (self *Node) IsStacked() bool {
+	return self.Layout == "stacked" || self.Layout == "tabbed"
+}
+
+// WorkspaceOf returns the workspace containing the node with the specified id.
+func (self *Node) WorkspaceOf(id int) *Node {
+	for _, ws := range self.Workspaces() {
+		if ws.Find(func(n *Node) bool { return n.Id == id }) != nil {
+			return ws
+		}
+	}
+	return nil
+}
+
+// FocusOrder returns the application windows in the tree rooted at this node
+// ordered from most to least recently focused, as recorded in the focus
+// lists of their ancestors.
+func (self *Node) FocusOrder() (ans []*Node) {
+	var visit func(*Node)
+	visit = func(n *Node) {
+		if n.IsView() {
+			ans = append(ans, n)
+			return
+		}
+		children := append(slices.Clone(n.Nodes), n.Floating_nodes...)
+		rank := func(c *Node) int {
+			if idx := slices.Index(n.Focus, c.Id); idx > -1 {
+				return idx
+			}
+			return len(n.Focus)
+		}
+		slices.SortStableFunc(children, func(a, b *Node) int { return rank(a) - rank(b) })
+		for _, c := range children {
+			visit(c)
+		}
+	}
+	visit(self)
+	return
+}
+
+// Workspaces returns all workspace nodes in the tree rooted at this node.
+func (self *Node) Workspaces() (ans []*Node) {
+	walk_nodes(self, func(n *Node) {
+		if n.Type == "workspace" {
+			ans = append(ans, n)
+		}
+	})
+	return
+}
+
+// }}}